@@ -0,0 +1,346 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/dnsproxy"
+	"github.com/samuelngs/smartdns/log"
+	"github.com/samuelngs/smartdns/sniproxy"
+)
+
+var logger = log.DefaultLogger.Named("admin")
+
+// Proxy inspects the sni-proxy and closes its live connections
+type Proxy interface {
+	Sessions() []sniproxy.SessionInfo
+	Kill(id uint64) bool
+	TopHosts(n int) []sniproxy.HostStats
+	Usage() map[string]sniproxy.AccountUsage
+}
+
+// DNS inspects the dns-proxy
+type DNS interface {
+	Queries(n int) []dnsproxy.QueryInfo
+	Certificate() dnsproxy.CertStatus
+}
+
+// Server is the management api of smartdns
+type Server struct {
+	conf  *config.Config
+	proxy Proxy
+	dns   DNS
+	mux   *http.ServeMux
+}
+
+// New creates the management api for the configuration and the servers
+func New(conf *config.Config, proxy Proxy, dns DNS) *Server {
+	s := &Server{conf: conf, proxy: proxy, dns: dns, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/api/rules", s.handleRules)
+	s.mux.HandleFunc("/api/rules/", s.handleRule)
+	s.mux.HandleFunc("/api/network", s.handleNetwork)
+	s.mux.HandleFunc("/api/network/allowed/", s.handleNetworkIP)
+	s.mux.HandleFunc("/api/network/blocked/", s.handleNetworkIP)
+	s.mux.HandleFunc("/api/sessions", s.handleSessions)
+	s.mux.HandleFunc("/api/sessions/", s.handleSession)
+	s.mux.HandleFunc("/api/reload", s.handleReload)
+	s.mux.HandleFunc("/api/queries", s.handleQueries)
+	s.mux.HandleFunc("/api/hosts", s.handleHosts)
+	s.mux.HandleFunc("/api/usage", s.handleUsage)
+	s.mux.HandleFunc("/api/certificate", s.handleCertificate)
+	s.mux.HandleFunc("/api/log/levels", s.handleLogLevels)
+	return s
+}
+
+// ListenAndServe serves the api on the configured address
+func (s *Server) ListenAndServe() error {
+	if len(s.conf.Admin.Token) == 0 {
+		return errors.New("admin api requires a token")
+	}
+	logger.Debug("serving admin api", log.String("addr", s.conf.Admin.Listen))
+	return http.ListenAndServe(s.conf.Admin.Listen, s)
+}
+
+// ServeHTTP authenticates the request before it is routed, the dashboard
+// is served to anyone since it only asks for the token and calls the api
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" {
+		serveDashboard(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="smartdns"`)
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token := s.conf.Admin.Token
+	auth := r.Header.Get("Authorization")
+	if len(token) == 0 || !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) == 1
+}
+
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.conf.Rules())
+	case http.MethodPost:
+		rule := new(config.DNSResolve)
+		if err := json.NewDecoder(r.Body).Decode(rule); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := s.conf.AddRule(rule); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.Info("dns rule added", log.String("name", rule.Name))
+		s.changed(w, http.StatusCreated, rule)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) handleRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+	name, err := url.PathUnescape(strings.TrimPrefix(r.URL.Path, "/api/rules/"))
+	if err != nil || len(name) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid rule name")
+		return
+	}
+	if !s.conf.RemoveRule(name) {
+		writeError(w, http.StatusNotFound, "rule not found")
+		return
+	}
+	logger.Info("dns rule removed", log.String("name", name))
+	s.changed(w, http.StatusOK, nil)
+}
+
+func (s *Server) handleNetwork(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, network(s.conf.Net()))
+}
+
+// handleNetworkIP adds the address in the path to the allowed or the blocked
+// list on PUT and removes it on DELETE
+func (s *Server) handleNetworkIP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/network/")
+	i := strings.IndexByte(path, '/')
+	list, ip := path[:i], net.ParseIP(path[i+1:])
+	if ip == nil {
+		writeError(w, http.StatusBadRequest, "invalid ip address")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPut && list == "allowed":
+		s.conf.AllowIP(ip)
+	case r.Method == http.MethodPut && list == "blocked":
+		s.conf.BlockIP(ip)
+	case r.Method == http.MethodDelete && list == "allowed":
+		if !s.conf.RemoveAllowedIP(ip) {
+			writeError(w, http.StatusNotFound, "ip address not found")
+			return
+		}
+	case r.Method == http.MethodDelete && list == "blocked":
+		if !s.conf.RemoveBlockedIP(ip) {
+			writeError(w, http.StatusNotFound, "ip address not found")
+			return
+		}
+	default:
+		methodNotAllowed(w, http.MethodPut, http.MethodDelete)
+		return
+	}
+	logger.Info(
+		"network list changed",
+		log.String("list", list),
+		log.String("method", r.Method),
+		log.IP("ip", ip))
+	s.changed(w, http.StatusOK, network(s.conf.Net()))
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.proxy.Sessions())
+}
+
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/api/sessions/"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid session id")
+		return
+	}
+	if !s.proxy.Kill(id) {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	logger.Info("session killed", log.String("id", strconv.FormatUint(id, 10)))
+	writeJSON(w, http.StatusOK, nil)
+}
+
+func (s *Server) handleQueries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.dns.Queries(limit(r, 100)))
+}
+
+func (s *Server) handleHosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.proxy.TopHosts(limit(r, 20)))
+}
+
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.proxy.Usage())
+}
+
+func (s *Server) handleCertificate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.dns.Certificate())
+}
+
+type logLevels struct {
+	Levels string `json:"levels"`
+}
+
+// handleLogLevels returns the log levels, or sets them from a list such as
+// "info,sniproxy=trace"
+func (s *Server) handleLogLevels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, logLevels{log.Levels()})
+	case http.MethodPut:
+		var o logLevels
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := log.SetLevels(o.Levels); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.Info("log levels changed", log.String("levels", log.Levels()))
+		writeJSON(w, http.StatusOK, logLevels{log.Levels()})
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
+
+// handleReload reads the configuration file again and applies the settings
+// that can be changed at runtime
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	conf, err := config.FromFile(s.conf.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.conf.Reload(conf)
+	logger.Info("configuration reloaded", log.String("path", s.conf.Path))
+	writeJSON(w, http.StatusOK, nil)
+}
+
+// changed saves the configuration when write back is enabled and responds
+// with the value
+func (s *Server) changed(w http.ResponseWriter, status int, v interface{}) {
+	if s.conf.Admin.WriteBack {
+		if err := s.conf.Save(); err != nil {
+			logger.Warn("could not save configuration", log.Error(err))
+			writeError(w, http.StatusInternalServerError, "change applied but not saved: "+err.Error())
+			return
+		}
+	}
+	writeJSON(w, status, v)
+}
+
+type networkLists struct {
+	AllowedIPs  []net.IP `json:"allowed_ips"`
+	BlockedIPs  []net.IP `json:"blocked_ips"`
+	DefaultDeny bool     `json:"default_deny"`
+}
+
+func network(n *config.Network) networkLists {
+	return networkLists{AllowedIPs: n.AllowedIPs, BlockedIPs: n.BlockedIPs, DefaultDeny: n.DefaultDeny}
+}
+
+// limit returns the limit query parameter, or the default value if it is
+// missing or invalid
+func limit(r *http.Request, def int) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if v == nil {
+		v = struct{}{}
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
@@ -0,0 +1,249 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package admin_test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samuelngs/smartdns/admin"
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/dnsproxy"
+	"github.com/samuelngs/smartdns/log"
+	"github.com/samuelngs/smartdns/sniproxy"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProxy struct {
+	list   []sniproxy.SessionInfo
+	killed []uint64
+}
+
+func (f *fakeProxy) Sessions() []sniproxy.SessionInfo {
+	return f.list
+}
+
+func (f *fakeProxy) TopHosts(n int) []sniproxy.HostStats {
+	return []sniproxy.HostStats{{Hostname: "netflix.com", Connections: int64(n)}}
+}
+
+func (f *fakeProxy) Usage() map[string]sniproxy.AccountUsage {
+	return map[string]sniproxy.AccountUsage{"user:alice": {Monthly: 1024}}
+}
+
+func (f *fakeProxy) Kill(id uint64) bool {
+	for _, s := range f.list {
+		if s.ID == id {
+			f.killed = append(f.killed, id)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeDNS struct{}
+
+func (fakeDNS) Queries(n int) []dnsproxy.QueryInfo {
+	return make([]dnsproxy.QueryInfo, n)
+}
+
+func (fakeDNS) Certificate() dnsproxy.CertStatus {
+	return dnsproxy.CertStatus{State: dnsproxy.CertPending, Hostname: "dns.example.com"}
+}
+
+func newTestConfig(t *testing.T) (*config.Config, func()) {
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := config.DefaultConfig()
+	conf.Path = filepath.Join(dir, "smartdns.yaml")
+	conf.Admin.Token = "secret"
+	return conf, func() { os.RemoveAll(dir) }
+}
+
+func do(h http.Handler, method, path, token string, body io.Reader) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, body)
+	if len(token) > 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthorization(t *testing.T) {
+	conf, cleanup := newTestConfig(t)
+	defer cleanup()
+	s := admin.New(conf, new(fakeProxy), fakeDNS{})
+
+	assert.Equal(t, http.StatusUnauthorized, do(s, "GET", "/api/rules", "", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(s, "GET", "/api/rules", "wrong", nil).Code)
+	assert.Equal(t, http.StatusOK, do(s, "GET", "/api/rules", "secret", nil).Code)
+
+	conf.Admin.Token = ""
+	assert.Equal(t, http.StatusUnauthorized, do(s, "GET", "/api/rules", "", nil).Code)
+}
+
+func TestRules(t *testing.T) {
+	conf, cleanup := newTestConfig(t)
+	defer cleanup()
+	s := admin.New(conf, new(fakeProxy), fakeDNS{})
+
+	w := do(s, "POST", "/api/rules", "secret", strings.NewReader(`{"name":"netflix.com","nameserver":"-","ttl":60}`))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = do(s, "POST", "/api/rules", "secret", strings.NewReader(`{"name":"bbc.co.uk","ip":"not an ip"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	assert.True(t, conf.IsAllowedHost("www.netflix.com"))
+	assert.Len(t, conf.Rules(), 1)
+
+	// a rule with the same name replaces the existing one
+	w = do(s, "POST", "/api/rules", "secret", strings.NewReader(`{"name":"Netflix.com.","ip":"1.2.3.4","ttl":60}`))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Len(t, conf.Rules(), 1)
+	assert.False(t, conf.IsAllowedHost("www.netflix.com"))
+
+	var rules []*config.DNSResolve
+	w = do(s, "GET", "/api/rules", "secret", nil)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&rules))
+	assert.Equal(t, []*config.DNSResolve{{Name: "Netflix.com.", IP: "1.2.3.4", TTL: 60}}, rules)
+
+	assert.Equal(t, http.StatusOK, do(s, "DELETE", "/api/rules/netflix.com", "secret", nil).Code)
+	assert.Equal(t, http.StatusNotFound, do(s, "DELETE", "/api/rules/netflix.com", "secret", nil).Code)
+	assert.Len(t, conf.Rules(), 0)
+}
+
+func TestNetwork(t *testing.T) {
+	conf, cleanup := newTestConfig(t)
+	defer cleanup()
+	s := admin.New(conf, new(fakeProxy), fakeDNS{})
+	network := conf.Net()
+
+	assert.Equal(t, http.StatusOK, do(s, "PUT", "/api/network/allowed/10.0.0.1", "secret", nil).Code)
+	assert.Equal(t, http.StatusOK, do(s, "PUT", "/api/network/blocked/2001:db8::1", "secret", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, do(s, "PUT", "/api/network/allowed/nope", "secret", nil).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(s, "GET", "/api/network/allowed/10.0.0.1", "secret", nil).Code)
+
+	assert.True(t, conf.IsAllowedIP("10.0.0.1"))
+	assert.False(t, conf.IsAllowedIP("10.0.0.2"))
+	assert.False(t, conf.IsAllowedIP("2001:db8::1"))
+	// the network is replaced rather than modified
+	assert.Len(t, network.AllowedIPs, 0)
+
+	assert.Equal(t, http.StatusOK, do(s, "DELETE", "/api/network/allowed/10.0.0.1", "secret", nil).Code)
+	assert.Equal(t, http.StatusNotFound, do(s, "DELETE", "/api/network/allowed/10.0.0.1", "secret", nil).Code)
+	assert.Equal(t, []net.IP{}, conf.Net().AllowedIPs)
+}
+
+func TestSessions(t *testing.T) {
+	conf, cleanup := newTestConfig(t)
+	defer cleanup()
+	proxy := &fakeProxy{list: []sniproxy.SessionInfo{{ID: 7, Hostname: "netflix.com", Port: 443}}}
+	s := admin.New(conf, proxy, fakeDNS{})
+
+	var list []sniproxy.SessionInfo
+	w := do(s, "GET", "/api/sessions", "secret", nil)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	assert.Equal(t, proxy.list, list)
+
+	assert.Equal(t, http.StatusOK, do(s, "DELETE", "/api/sessions/7", "secret", nil).Code)
+	assert.Equal(t, http.StatusNotFound, do(s, "DELETE", "/api/sessions/8", "secret", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, do(s, "DELETE", "/api/sessions/x", "secret", nil).Code)
+	assert.Equal(t, []uint64{7}, proxy.killed)
+}
+
+func TestWriteBackAndReload(t *testing.T) {
+	conf, cleanup := newTestConfig(t)
+	defer cleanup()
+	conf.Admin.WriteBack = true
+	s := admin.New(conf, new(fakeProxy), fakeDNS{})
+
+	assert.Equal(t, http.StatusCreated, do(s, "POST", "/api/rules", "secret", strings.NewReader(`{"name":"netflix.com","nameserver":"-","ttl":60}`)).Code)
+	assert.Equal(t, http.StatusOK, do(s, "PUT", "/api/network/allowed/10.0.0.1", "secret", nil).Code)
+
+	saved, err := config.FromFile(conf.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, conf.Rules(), saved.Rules())
+	assert.True(t, saved.IsAllowedIP("10.0.0.1"))
+	assert.False(t, saved.IsAllowedIP("10.0.0.2"))
+
+	// changes made to the file are applied on reload
+	conf.RemoveRule("netflix.com")
+	conf.RemoveAllowedIP(net.ParseIP("10.0.0.1"))
+	assert.Equal(t, http.StatusOK, do(s, "POST", "/api/reload", "secret", nil).Code)
+	assert.Len(t, conf.Rules(), 1)
+	assert.False(t, conf.IsAllowedIP("10.0.0.2"))
+}
+
+func TestDashboard(t *testing.T) {
+	conf, cleanup := newTestConfig(t)
+	defer cleanup()
+	s := admin.New(conf, new(fakeProxy), fakeDNS{})
+
+	w := do(s, "GET", "/", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), "/api/queries")
+
+	// the data behind the dashboard requires the token
+	assert.Equal(t, http.StatusUnauthorized, do(s, "GET", "/api/queries", "", nil).Code)
+
+	var queries []dnsproxy.QueryInfo
+	w = do(s, "GET", "/api/queries?limit=3", "secret", nil)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&queries))
+	assert.Len(t, queries, 3)
+
+	var hosts []sniproxy.HostStats
+	w = do(s, "GET", "/api/hosts", "secret", nil)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&hosts))
+	assert.Equal(t, []sniproxy.HostStats{{Hostname: "netflix.com", Connections: 20}}, hosts)
+
+	var cert dnsproxy.CertStatus
+	w = do(s, "GET", "/api/certificate", "secret", nil)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&cert))
+	assert.Equal(t, dnsproxy.CertPending, cert.State)
+
+	var usage map[string]sniproxy.AccountUsage
+	w = do(s, "GET", "/api/usage", "secret", nil)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&usage))
+	assert.Equal(t, int64(1024), usage["user:alice"].Monthly)
+}
+
+func TestLogLevels(t *testing.T) {
+	conf, cleanup := newTestConfig(t)
+	defer cleanup()
+	s := admin.New(conf, new(fakeProxy), fakeDNS{})
+	defer log.SetLevels(log.Levels())
+
+	w := do(s, "PUT", "/api/log/levels", "secret", strings.NewReader(`{"levels":"warn,sniproxy=trace"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusBadRequest, do(s, "PUT", "/api/log/levels", "secret", strings.NewReader(`{"levels":"loud"}`)).Code)
+
+	var o map[string]string
+	w = do(s, "GET", "/api/log/levels", "secret", nil)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&o))
+	assert.Equal(t, "warn,sniproxy=trace", o["levels"])
+}
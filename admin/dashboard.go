@@ -0,0 +1,201 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// started is reported as the modification time of the dashboard so that the
+// browsers revalidate it after an upgrade
+var started = time.Now()
+
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'unsafe-inline'; script-src 'unsafe-inline'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	http.ServeContent(w, r, "index.html", started, strings.NewReader(dashboardHTML))
+}
+
+// dashboardHTML is the dashboard page, it is self-contained so that the
+// binary does not depend on any file at runtime
+const dashboardHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>smartdns</title>
+<style>
+body { font: 14px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; color: #222; background: #f4f5f7; }
+header { background: #1f2937; color: #fff; padding: 12px 20px; display: flex; align-items: center; gap: 12px; }
+header h1 { font-size: 18px; margin: 0; flex: 1; }
+header input { padding: 4px 8px; border-radius: 4px; border: 0; width: 220px; }
+main { display: grid; grid-template-columns: repeat(auto-fit, minmax(480px, 1fr)); gap: 16px; padding: 16px; }
+section { background: #fff; border-radius: 6px; padding: 12px 16px; box-shadow: 0 1px 2px rgba(0,0,0,.08); overflow: auto; max-height: 480px; }
+section.wide { grid-column: 1 / -1; }
+h2 { font-size: 15px; margin: 0 0 8px; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 3px 8px 3px 0; border-bottom: 1px solid #eee; white-space: nowrap; }
+th { color: #666; font-weight: 600; }
+td.num { text-align: right; }
+input.filter { margin-bottom: 8px; padding: 4px 8px; width: 260px; }
+.ok { color: #15803d; } .warn { color: #b45309; } .bad { color: #b91c1c; }
+#error { color: #b91c1c; }
+button { cursor: pointer; }
+</style>
+</head>
+<body>
+<header>
+<h1>smartdns</h1>
+<span id="error"></span>
+<input id="token" type="password" placeholder="admin token">
+</header>
+<main>
+<section class="wide">
+<h2>Recent DNS queries</h2>
+<input class="filter" id="query-filter" placeholder="filter by client or name">
+<table><thead><tr><th>Time</th><th>Client</th><th>Name</th><th>Type</th><th>Action</th><th>Rcode</th><th>Latency</th></tr></thead><tbody id="queries"></tbody></table>
+</section>
+<section>
+<h2>Top proxied domains</h2>
+<table><thead><tr><th>Hostname</th><th>Connections</th><th>Up</th><th>Down</th></tr></thead><tbody id="hosts"></tbody></table>
+</section>
+<section>
+<h2>Certificate</h2>
+<div id="certificate"></div>
+<h2 style="margin-top:16px">Clients</h2>
+<div id="network"></div>
+<table><thead><tr><th>Account</th><th>Today</th><th>Month</th></tr></thead><tbody id="usage"></tbody></table>
+</section>
+<section class="wide">
+<h2>Active connections</h2>
+<table><thead><tr><th>ID</th><th>Client</th><th>Port</th><th>Protocol</th><th>Hostname</th><th>Upstream</th><th>Up</th><th>Down</th><th>Age</th><th></th></tr></thead><tbody id="sessions"></tbody></table>
+</section>
+</main>
+<script>
+(function () {
+  var tokenInput = document.getElementById("token");
+  tokenInput.value = localStorage.getItem("smartdns-token") || "";
+  tokenInput.addEventListener("change", function () {
+    localStorage.setItem("smartdns-token", tokenInput.value);
+    refresh();
+  });
+  document.getElementById("query-filter").addEventListener("input", function () { refresh(); });
+
+  function esc(s) {
+    return String(s == null ? "" : s).replace(/[&<>"']/g, function (c) {
+      return {"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;", "'": "&#39;"}[c];
+    });
+  }
+  function bytes(n) {
+    var units = ["B", "KiB", "MiB", "GiB", "TiB"], i = 0;
+    while (n >= 1024 && i < units.length - 1) { n /= 1024; i++; }
+    return n.toFixed(i ? 1 : 0) + " " + units[i];
+  }
+  function duration(s) {
+    if (s < 1) { return (s * 1000).toFixed(1) + " ms"; }
+    if (s < 120) { return s.toFixed(0) + " s"; }
+    if (s < 7200) { return (s / 60).toFixed(0) + " min"; }
+    return (s / 3600).toFixed(1) + " h";
+  }
+  function row(cells) {
+    return "<tr>" + cells.map(function (c) {
+      return typeof c === "number" ? "<td class=\"num\">" + c + "</td>" : "<td>" + c + "</td>";
+    }).join("") + "</tr>";
+  }
+  function api(method, path) {
+    return fetch(path, {method: method, headers: {"Authorization": "Bearer " + tokenInput.value}}).then(function (r) {
+      if (r.status === 401) { throw new Error("invalid token"); }
+      if (!r.ok) { throw new Error(method + " " + path + ": " + r.status); }
+      return r.json();
+    });
+  }
+
+  function renderQueries(list) {
+    var filter = document.getElementById("query-filter").value.toLowerCase();
+    document.getElementById("queries").innerHTML = list.filter(function (q) {
+      return !filter || q.client.toLowerCase().indexOf(filter) >= 0 || q.name.toLowerCase().indexOf(filter) >= 0;
+    }).map(function (q) {
+      var cls = q.rcode === "NOERROR" ? "ok" : "bad";
+      return row([esc(new Date(q.time).toLocaleTimeString()), esc(q.client), esc(q.name), esc(q.type),
+        esc(q.action), "<span class=\"" + cls + "\">" + esc(q.rcode) + "</span>", esc(duration(q.duration_seconds))]);
+    }).join("");
+  }
+  function renderHosts(list) {
+    document.getElementById("hosts").innerHTML = list.map(function (h) {
+      return row([esc(h.hostname), h.connections, esc(bytes(h.bytes_up)), esc(bytes(h.bytes_down))]);
+    }).join("");
+  }
+  function renderSessions(list) {
+    document.getElementById("sessions").innerHTML = list.map(function (s) {
+      return row([s.id, esc(s.client), s.port, esc(s.protocol), esc(s.hostname), esc(s.upstream),
+        esc(bytes(s.bytes_up)), esc(bytes(s.bytes_down)), esc(duration(s.age_seconds)),
+        "<button data-id=\"" + s.id + "\">kill</button>"]);
+    }).join("");
+  }
+  function renderCertificate(c) {
+    var cls = {issued: "ok", pending: "warn", failed: "bad"}[c.state] || "";
+    var html = "<span class=\"" + cls + "\">" + esc(c.state || "unknown") + "</span> " + esc(c.hostname);
+    if (c.not_after) { html += ", expires " + esc(new Date(c.not_after).toLocaleString()); }
+    if (c.error) { html += "<br><span class=\"bad\">" + esc(c.error) + "</span>"; }
+    document.getElementById("certificate").innerHTML = html;
+  }
+  function renderNetwork(n) {
+    var allowed = (n.allowed_ips || []).length ? n.allowed_ips.map(esc).join(", ") : (n.default_deny ? "none" : "everyone");
+    var blocked = (n.blocked_ips || []).length ? n.blocked_ips.map(esc).join(", ") : "none";
+    document.getElementById("network").innerHTML = "<p>Allowed: " + allowed + "<br>Blocked: " + blocked + "</p>";
+  }
+  function renderUsage(m) {
+    document.getElementById("usage").innerHTML = Object.keys(m).sort().map(function (k) {
+      return row([esc(k), esc(bytes(m[k].daily)), esc(bytes(m[k].monthly))]);
+    }).join("");
+  }
+
+  document.getElementById("sessions").addEventListener("click", function (e) {
+    var id = e.target.getAttribute("data-id");
+    if (id && confirm("Close connection " + id + "?")) {
+      api("DELETE", "/api/sessions/" + id).then(refresh, showError);
+    }
+  });
+
+  function showError(err) {
+    document.getElementById("error").textContent = err.message;
+  }
+  function refresh() {
+    if (!tokenInput.value) { showError(new Error("enter the admin token")); return; }
+    Promise.all([
+      api("GET", "/api/queries?limit=200").then(renderQueries),
+      api("GET", "/api/hosts?limit=25").then(renderHosts),
+      api("GET", "/api/sessions").then(renderSessions),
+      api("GET", "/api/certificate").then(renderCertificate),
+      api("GET", "/api/network").then(renderNetwork),
+      api("GET", "/api/usage").then(renderUsage)
+    ]).then(function () { showError({message: ""}); }, showError);
+  }
+  refresh();
+  setInterval(refresh, 5000);
+})();
+</script>
+</body>
+</html>
+`
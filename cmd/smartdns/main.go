@@ -17,9 +17,13 @@
 package main
 
 import (
+	"os"
+
+	"github.com/samuelngs/smartdns/admin"
 	"github.com/samuelngs/smartdns/config"
 	"github.com/samuelngs/smartdns/dnsproxy"
 	"github.com/samuelngs/smartdns/log"
+	"github.com/samuelngs/smartdns/metrics"
 	"github.com/samuelngs/smartdns/sniproxy"
 	"golang.org/x/sync/errgroup"
 )
@@ -29,16 +33,35 @@ var logger = log.DefaultLogger
 func main() {
 	var eg errgroup.Group
 
-	conf := config.DefaultConfig()
+	conf, err := config.FromFile(config.DefaultConfig().Path)
+	if os.IsNotExist(err) {
+		conf = config.DefaultConfig()
+	} else if err != nil {
+		logger.Fatal("could not read configuration", log.Error(err))
+		return
+	}
 	conf.DNS.TLS.Enabled = false
+	if outputs, err := conf.Log.Open(); err != nil {
+		logger.Warn("could not open log outputs", log.Error(err))
+	} else {
+		log.SetOutputs(outputs...)
+	}
 
 	sniproxy := sniproxy.NewSNIProxy(conf)
 	dnsproxy := dnsproxy.NewDNSProxy(conf)
+	sniproxy.SetQueryHistory(dnsproxy)
 
 	eg.Go(func() error { return sniproxy.Start() })
 	eg.Go(func() error { return dnsproxy.Start() })
 
+	if conf.Metrics.Enabled {
+		eg.Go(func() error { return metrics.ListenAndServe(conf.Metrics.Listen) })
+	}
+	if conf.Admin.Enabled {
+		eg.Go(admin.New(conf, sniproxy, dnsproxy).ListenAndServe)
+	}
+
 	if err := eg.Wait(); err != nil {
-		logger.Fatal(err.Error())
+		logger.Fatal("server stopped", log.Error(err))
 	}
 }
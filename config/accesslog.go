@@ -0,0 +1,42 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+// Defines the formats of the access log
+const (
+	AccessLogJSON     = "json"
+	AccessLogCombined = "combined"
+)
+
+// AccessLog configuration of the entries written when the sni-proxy closes a
+// connection
+type AccessLog struct {
+	Enabled bool `yaml:"enabled"`
+	// Format is json for json lines or combined for lines in the style of
+	// the combined log format of the web servers
+	Format string  `yaml:"format"`
+	Sinks  []*Sink `yaml:"sinks"`
+}
+
+// DefaultAccessLog generates default settings for the access log
+func DefaultAccessLog() *AccessLog {
+	return &AccessLog{
+		Enabled: false,
+		Format:  AccessLogJSON,
+		Sinks:   []*Sink{{Type: SinkStdout}},
+	}
+}
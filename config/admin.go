@@ -0,0 +1,36 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+// Admin configuration of the management api, the requests are authenticated
+// with the bearer token
+type Admin struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"`
+	Token   string `yaml:"token"`
+	// WriteBack saves the changes made through the api to the configuration
+	// file
+	WriteBack bool `yaml:"write_back"`
+}
+
+// DefaultAdmin generates default settings for the management api
+func DefaultAdmin() *Admin {
+	return &Admin{
+		Enabled: false,
+		Listen:  "127.0.0.1:9154",
+	}
+}
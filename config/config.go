@@ -18,7 +18,10 @@ package config
 
 import (
 	"io/ioutil"
+	"net"
 	"os"
+	"strconv"
+	"sync"
 
 	"github.com/go-yaml/yaml"
 )
@@ -29,6 +32,12 @@ type Config struct {
 	Network  *Network  `yaml:"network"`
 	DNS      *DNS      `yaml:"dns"`
 	SNIProxy *SNIProxy `yaml:"proxy"`
+	Metrics  *Metrics  `yaml:"metrics"`
+	Admin    *Admin    `yaml:"admin"`
+	Log      *Log      `yaml:"log"`
+
+	// mu guards the settings that can be changed at runtime
+	mu sync.RWMutex
 }
 
 // DefaultConfig generates the default settings for smartdns
@@ -38,7 +47,39 @@ func DefaultConfig() *Config {
 		Network:  DefaultNetwork(),
 		DNS:      DefaultDNS(),
 		SNIProxy: DefaultSNIProxy(),
+		Metrics:  DefaultMetrics(),
+		Admin:    DefaultAdmin(),
+		Log:      DefaultLog(),
+	}
+}
+
+// ProxyPorts returns the ports of the sni-proxy without the ones used by the
+// other listeners of smartdns
+func (c *Config) ProxyPorts() []int {
+	used := make(map[int]struct{})
+	if port, ok := listenPort(c.Metrics.Listen); ok && c.Metrics.Enabled {
+		used[port] = struct{}{}
+	}
+	if port, ok := listenPort(c.Admin.Listen); ok && c.Admin.Enabled {
+		used[port] = struct{}{}
+	}
+	ports := c.SNIProxy.AllowedPorts()
+	o := ports[:0]
+	for _, p := range ports {
+		if _, ok := used[p]; !ok {
+			o = append(o, p)
+		}
+	}
+	return o
+}
+
+func listenPort(addr string) (int, bool) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, false
 	}
+	n, err := strconv.Atoi(port)
+	return n, err == nil
 }
 
 // Read reads the yaml configuration from bytes
@@ -25,13 +25,31 @@ import (
 type DNS struct {
 	TLS            *DNSTLS       `yaml:"tls"`
 	DNSResolveList []*DNSResolve `yaml:"resolve_dns"`
+	RateLimit      *DNSRateLimit `yaml:"rate_limit"`
+	QueryLog       *QueryLog     `yaml:"query_log"`
+	DNSTap         *DNSTap       `yaml:"dnstap"`
 }
 
 // DNSTLS configuration
 type DNSTLS struct {
-	Enabled  bool   `yaml:"enabled"`
-	Email    string `yaml:"email"`
-	Hostname string `yaml:"hostname"`
+	Enabled   bool          `yaml:"enabled"`
+	Email     string        `yaml:"email"`
+	Hostname  string        `yaml:"hostname"`
+	RateLimit *DNSRateLimit `yaml:"rate_limit"`
+}
+
+// DNSRateLimit configuration of a dns listener, the clients are grouped by
+// their network prefix and a zero value disables the limit
+type DNSRateLimit struct {
+	QueriesPerSecond float64 `yaml:"queries_per_second"`
+	QueryBurst       int     `yaml:"query_burst"`
+	// ResponsesPerSecond limits the identical responses sent to a network,
+	// every Slip-th response over the limit is sent truncated so that real
+	// clients can retry over tcp. Only udp responses are limited.
+	ResponsesPerSecond float64 `yaml:"responses_per_second"`
+	Slip               int     `yaml:"slip"`
+	IPv4PrefixLen      int     `yaml:"ipv4_prefix_len"`
+	IPv6PrefixLen      int     `yaml:"ipv6_prefix_len"`
 }
 
 // DefaultDNS generates default settings for DNS
@@ -39,14 +57,32 @@ func DefaultDNS() *DNS {
 	return &DNS{
 		TLS:            DefaultDNSTLS(),
 		DNSResolveList: make([]*DNSResolve, 0),
+		RateLimit:      DefaultDNSRateLimit(),
+		QueryLog:       DefaultQueryLog(),
+		DNSTap:         DefaultDNSTap(),
 	}
 }
 
 // DefaultDNSTLS generates default settings for dns-tls
 func DefaultDNSTLS() *DNSTLS {
+	rl := DefaultDNSRateLimit()
+	rl.ResponsesPerSecond = 0
 	return &DNSTLS{
-		Enabled:  true,
-		Email:    fmt.Sprintf("admin@%s", os.Getenv("hostname")),
-		Hostname: os.Getenv("hostname"),
+		Enabled:   true,
+		Email:     fmt.Sprintf("admin@%s", os.Getenv("hostname")),
+		Hostname:  os.Getenv("hostname"),
+		RateLimit: rl,
+	}
+}
+
+// DefaultDNSRateLimit generates default settings for dns rate limiting
+func DefaultDNSRateLimit() *DNSRateLimit {
+	return &DNSRateLimit{
+		QueriesPerSecond:   100,
+		QueryBurst:         200,
+		ResponsesPerSecond: 20,
+		Slip:               2,
+		IPv4PrefixLen:      24,
+		IPv6PrefixLen:      56,
 	}
 }
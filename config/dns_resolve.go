@@ -26,10 +26,12 @@ type DNSResolveList []*DNSResolve
 
 // DNSResolve query rule
 type DNSResolve struct {
-	Name       string `yaml:"name"`
-	Nameserver string `yaml:"nameserver,omitempty"`
-	IP         string `yaml:"ip,omitempty"`
-	TTL        int    `yaml:"ttl"`
+	Name       string `yaml:"name" json:"name"`
+	Nameserver string `yaml:"nameserver,omitempty" json:"nameserver,omitempty"`
+	IP         string `yaml:"ip,omitempty" json:"ip,omitempty"`
+	TTL        int    `yaml:"ttl" json:"ttl"`
+	Egress     string `yaml:"egress,omitempty" json:"egress,omitempty"`
+	Source     string `yaml:"source,omitempty" json:"source,omitempty"`
 }
 
 // IsValid returns true if the custom dns configuration is valid
@@ -83,18 +85,17 @@ func ResolveWithNameserver(name, ns string, ttl int) *DNSResolve {
 	return nil
 }
 
+// IsProxy returns true if the domain name is resolved to the sni-proxy
+func (d *DNSResolve) IsProxy() bool {
+	return d.Nameserver == "-"
+}
+
 // MatchDNS returns the dns rule that matches the hostname
 func (d DNSResolveList) MatchDNS(name string) *DNSResolve {
 	var matches []*DNSResolve
 	for _, rule := range d {
-		if rule != nil {
-			o := rule.Name
-			if len(o) > 0 && o[len(o)-1] != 0x2e {
-				o += string(0x2e)
-			}
-			if strings.HasSuffix(name, o) {
-				matches = append(matches, rule)
-			}
+		if rule != nil && MatchName(rule.Name, name) {
+			matches = append(matches, rule)
 		}
 	}
 	if len(matches) > 0 {
@@ -108,3 +109,24 @@ func (d DNSResolveList) MatchDNS(name string) *DNSResolve {
 	}
 	return nil
 }
+
+// MatchName returns true if name equals to the pattern or is a subdomain
+// of it, the comparison is case-insensitive and ignores the trailing dot
+func MatchName(pattern, name string) bool {
+	pattern, name = fqdn(pattern), fqdn(name)
+	switch {
+	case pattern == ".":
+		return true
+	case name == pattern:
+		return true
+	}
+	return strings.HasSuffix(name, "."+pattern)
+}
+
+func fqdn(name string) string {
+	name = strings.ToLower(name)
+	if len(name) == 0 || name[len(name)-1] != '.' {
+		name += "."
+	}
+	return name
+}
@@ -0,0 +1,45 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import "time"
+
+// DNSTap configuration of the dnstap messages of the client queries and the
+// queries forwarded to the upstream nameservers
+type DNSTap struct {
+	Enabled bool `yaml:"enabled"`
+	// Network is unix or tcp to stream the messages to a collector, or
+	// file to write them to the file at Address
+	Network  string `yaml:"network"`
+	Address  string `yaml:"address"`
+	Identity string `yaml:"identity"`
+	// QueueSize is the number of messages waiting to be written, the
+	// messages are dropped when the collector is too slow to keep up
+	QueueSize int           `yaml:"queue_size"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
+// DefaultDNSTap generates default settings for dnstap
+func DefaultDNSTap() *DNSTap {
+	return &DNSTap{
+		Enabled:   false,
+		Network:   "unix",
+		Address:   "/var/run/smartdns/dnstap.sock",
+		QueueSize: 4096,
+		Timeout:   time.Second * 5,
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import "time"
+
+// Defines the policies for the connections with an encrypted ClientHello
+const (
+	// ECHForward forwards the connection to the public name of the outer
+	// ClientHello
+	ECHForward = "forward"
+	// ECHReject refuses the connection
+	ECHReject = "reject"
+	// ECHHistory forwards the connection to the name the client resolved to
+	// the proxy most recently, or refuses it if there is none
+	ECHHistory = "history"
+)
+
+// ECH configuration of the connections that use Encrypted ClientHello, the
+// server name they send is the public name of the client-facing server
+// rather than the name of the service
+type ECH struct {
+	Policy string `yaml:"policy"`
+	// HistoryWindow is how recent the dns queries of the client have to be
+	// for the history policy
+	HistoryWindow time.Duration `yaml:"history_window"`
+	// StripDNS removes the ECH configs from the HTTPS records of the names
+	// resolved to the proxy so that the clients do not use ECH
+	StripDNS bool `yaml:"strip_dns"`
+}
+
+// DefaultECH generates default settings that forward to the public name
+func DefaultECH() *ECH {
+	return &ECH{
+		Policy:        ECHForward,
+		HistoryWindow: time.Second * 30,
+		StripDNS:      true,
+	}
+}
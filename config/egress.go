@@ -0,0 +1,86 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"fmt"
+	"net"
+)
+
+// Defines the types of egress
+const (
+	EgressDirect = "direct"
+	EgressSOCKS5 = "socks5"
+	EgressHTTP   = "http"
+)
+
+// Egress configuration of an upstream the sni-proxy connects through
+type Egress struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Address  string `yaml:"address,omitempty"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	Via      string `yaml:"via,omitempty"`
+}
+
+// IsValid returns true if the egress configuration is valid
+func (e *Egress) IsValid() bool {
+	switch {
+	case len(e.Name) == 0:
+		return false
+	case e.Type == EgressDirect:
+		return len(e.Address) == 0 && len(e.Via) == 0
+	case e.Type == EgressSOCKS5, e.Type == EgressHTTP:
+		_, _, err := net.SplitHostPort(e.Address)
+		return err == nil
+	}
+	return false
+}
+
+// EgressChain returns the list of upstreams to connect through in order,
+// starting from the one closest to this server. A direct egress results in
+// an empty chain.
+func (s *SNIProxy) EgressChain(name string) ([]*Egress, error) {
+	var chain []*Egress
+	seen := map[string]struct{}{}
+	for len(name) > 0 && name != EgressDirect {
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("egress %q has a loop in its chain", name)
+		}
+		seen[name] = struct{}{}
+
+		var e *Egress
+		for _, o := range s.Egress {
+			if o != nil && o.Name == name {
+				e = o
+				break
+			}
+		}
+		switch {
+		case e == nil:
+			return nil, fmt.Errorf("egress %q is not defined", name)
+		case !e.IsValid():
+			return nil, fmt.Errorf("egress %q is not valid", name)
+		case e.Type == EgressDirect:
+			return chain, nil
+		}
+		chain = append([]*Egress{e}, chain...)
+		name = e.Via
+	}
+	return chain, nil
+}
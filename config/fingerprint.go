@@ -0,0 +1,72 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import "strings"
+
+// Fingerprints configuration of the TLS clients the sni-proxy accepts, the
+// entries are JA3 hashes or JA4 fingerprints, a part of a JA4 fingerprint
+// can be * to match any value
+type Fingerprints struct {
+	// Allowed lists the clients that are accepted, every other client is
+	// rejected when the list is not empty
+	Allowed []string `yaml:"allowed"`
+	// Denied lists the clients that are rejected
+	Denied []string `yaml:"denied"`
+}
+
+// DefaultFingerprints generates default settings that accept every client
+func DefaultFingerprints() *Fingerprints {
+	return &Fingerprints{
+		Allowed: make([]string, 0),
+		Denied:  make([]string, 0),
+	}
+}
+
+// Match returns whether the client with the fingerprints is allowed and the
+// entry that decided it, which is empty if none matched
+func (f *Fingerprints) Match(ja3, ja4 string) (bool, string) {
+	for _, entry := range f.Denied {
+		if MatchFingerprint(entry, ja3, ja4) {
+			return false, entry
+		}
+	}
+	for _, entry := range f.Allowed {
+		if MatchFingerprint(entry, ja3, ja4) {
+			return true, entry
+		}
+	}
+	return len(f.Allowed) == 0, ""
+}
+
+// MatchFingerprint returns true if the entry is the JA3 hash or matches the
+// JA4 fingerprint
+func MatchFingerprint(entry, ja3, ja4 string) bool {
+	if strings.EqualFold(entry, ja3) {
+		return true
+	}
+	parts, values := strings.Split(entry, "_"), strings.Split(ja4, "_")
+	if len(parts) != len(values) {
+		return false
+	}
+	for i, part := range parts {
+		if part != "*" && !strings.EqualFold(part, values[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+// Limits configuration of the connections accepted by the sni-proxy, a zero
+// value disables the limit
+type Limits struct {
+	MaxConns             int     `yaml:"max_conns"`
+	MaxConnsPerClient    int     `yaml:"max_conns_per_client"`
+	ConnRatePerClient    float64 `yaml:"conn_rate_per_client"`
+	ConnBurstPerClient   int     `yaml:"conn_burst_per_client"`
+	MaxPendingHandshakes int     `yaml:"max_pending_handshakes"`
+}
+
+// DefaultLimits generates default settings for connection limits
+func DefaultLimits() *Limits {
+	return &Limits{
+		MaxConns:             16384,
+		MaxConnsPerClient:    512,
+		ConnRatePerClient:    50,
+		ConnBurstPerClient:   100,
+		MaxPendingHandshakes: 2048,
+	}
+}
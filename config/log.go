@@ -0,0 +1,116 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/samuelngs/smartdns/log"
+)
+
+// Log configuration of the logger
+type Log struct {
+	// Format is console, text, json or logfmt, the console format is not
+	// colored when the output is not a terminal
+	Format string `yaml:"format"`
+	// Caller includes the source location of the log calls
+	Caller bool `yaml:"caller"`
+	// Outputs are the sinks the records are written to, the records are
+	// written to stdout if there is none
+	Outputs []*LogOutput `yaml:"outputs"`
+}
+
+// LogOutput configuration of a log output, the level and the format of the
+// logger are used when they are empty
+type LogOutput struct {
+	Sink   `yaml:",inline"`
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+	// Async writes the entries from a goroutine through a queue of
+	// QueueSize entries, which are dropped when it is full. The syslog and
+	// journald outputs are always written synchronously.
+	Async     bool `yaml:"async"`
+	QueueSize int  `yaml:"queue_size"`
+}
+
+// defaultLogQueueSize is the size of the queue of the async outputs
+const defaultLogQueueSize = 8192
+
+// DefaultLog generates default settings for the logger from the LOG_FORMAT
+// and LOG_CALLER environment variables
+func DefaultLog() *Log {
+	caller, _ := strconv.ParseBool(os.Getenv("LOG_CALLER"))
+	return &Log{
+		Format:  os.Getenv("LOG_FORMAT"),
+		Caller:  caller,
+		Outputs: make([]*LogOutput, 0),
+	}
+}
+
+// Open opens the sinks of the outputs
+func (l *Log) Open() ([]*log.Output, error) {
+	outputs := l.Outputs
+	if len(outputs) == 0 {
+		outputs = []*LogOutput{{Sink: Sink{Type: SinkStdout}}}
+	}
+	o := make([]*log.Output, 0, len(outputs))
+	for _, out := range outputs {
+		output, err := l.open(out)
+		if err != nil {
+			for _, opened := range o {
+				opened.Sink.Close()
+			}
+			return nil, err
+		}
+		o = append(o, output)
+	}
+	return o, nil
+}
+
+func (l *Log) open(out *LogOutput) (*log.Output, error) {
+	level := log.LogTrace
+	if len(out.Level) > 0 {
+		var err error
+		if level, err = log.ParseLevel(out.Level); err != nil {
+			return nil, err
+		}
+	}
+	format := out.Format
+	if len(format) == 0 {
+		format = l.Format
+	}
+	if len(format) == 0 {
+		format = log.EncoderConsole
+	}
+	e, err := log.NewEncoder(format, l.Caller)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := out.Sink.Open()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := sink.(log.RecordWriter); out.Async && !ok {
+		size := out.QueueSize
+		if size <= 0 {
+			size = defaultLogQueueSize
+		}
+		sink = log.NewAsyncSink(sink, size)
+	}
+	return log.NewOutput(sink, level, e), nil
+}
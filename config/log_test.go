@@ -0,0 +1,75 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "smartdns.log")
+
+	conf, err := config.Read([]byte(`
+log:
+  format: json
+  outputs:
+  - type: stdout
+    format: console
+  - type: file
+    path: ` + path + `
+    level: warn
+    max_size: 10
+    max_age: 24h
+    compress: true
+    async: true
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	out := conf.Log.Outputs[1]
+	assert.Equal(t, 10, out.MaxSize)
+	assert.Equal(t, time.Hour*24, out.MaxAge)
+	assert.True(t, out.Compress)
+
+	outputs, err := conf.Log.Open()
+	if !assert.NoError(t, err) || !assert.Len(t, outputs, 2) {
+		return
+	}
+	defer outputs[1].Sink.Close()
+	assert.Equal(t, log.LogTrace, outputs[0].Level)
+	assert.IsType(t, &log.ConsoleEncoder{}, outputs[0].Encoder)
+	assert.Equal(t, log.LogWarn, outputs[1].Level)
+	assert.IsType(t, &log.JSONEncoder{}, outputs[1].Encoder)
+	assert.IsType(t, &log.AsyncSink{}, outputs[1].Sink)
+
+	conf.Log.Outputs[1].Level = "verbose"
+	_, err = conf.Log.Open()
+	assert.Error(t, err)
+}
@@ -24,6 +24,9 @@ import (
 type Network struct {
 	AllowedIPs []net.IP `yaml:"allowed_ips"`
 	BlockedIPs []net.IP `yaml:"blocked_ips"`
+	// DefaultDeny rejects the addresses that are not in the allowed list,
+	// including when the list is empty
+	DefaultDeny bool `yaml:"default_deny"`
 }
 
 // DefaultNetwork configuration
@@ -37,7 +40,7 @@ func DefaultNetwork() *Network {
 // IsAllowedIP checks if the ip is allowed to make requests to this server
 func (n *Network) IsAllowedIP(s interface{}) bool {
 	if len(n.AllowedIPs) == 0 && len(n.BlockedIPs) == 0 {
-		return true
+		return !n.DefaultDeny
 	}
 	var ip net.IP
 	switch o := s.(type) {
@@ -74,5 +77,10 @@ func (n *Network) IsAllowedIP(s interface{}) bool {
 		return false
 	}
 
-	return true
+	return !n.DefaultDeny
+}
+
+// IsOpen returns true if every address is allowed to make requests
+func (n *Network) IsOpen() bool {
+	return len(n.AllowedIPs) == 0 && !n.DefaultDeny
 }
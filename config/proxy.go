@@ -32,6 +32,45 @@ type SNIProxy struct {
 	ConnTimeout time.Duration `yaml:"conn_timeout"`
 	DialTimeout time.Duration `yaml:"dial_timeout"`
 	DataTimeout time.Duration `yaml:"data_timeout"`
+
+	// AllowedHosts lists the extra domain names that are allowed to be
+	// proxied in addition to the proxy rules in resolve_dns
+	AllowedHosts []string `yaml:"allowed_hosts"`
+
+	// Egress defines the upstreams that proxied connections can be routed
+	// through, DefaultEgress is used when a rule does not select one
+	Egress        []*Egress `yaml:"egress"`
+	DefaultEgress string    `yaml:"default_egress"`
+
+	// Sources defines the pools of local addresses that outbound connections
+	// can be bound to, DefaultSource is used when a rule does not select one
+	Sources       []*Source `yaml:"sources"`
+	DefaultSource string    `yaml:"default_source"`
+
+	// Resolver defines the upstream nameservers that destinations are
+	// resolved with, the system resolver may point back to this server
+	Resolver *Resolver `yaml:"resolver"`
+
+	ProxyProtocol *ProxyProtocol `yaml:"proxy_protocol"`
+	Limits        *Limits        `yaml:"limits"`
+	Traffic       *Traffic       `yaml:"traffic"`
+	AccessLog     *AccessLog     `yaml:"access_log"`
+	Fingerprints  *Fingerprints  `yaml:"fingerprints"`
+	ECH           *ECH           `yaml:"ech"`
+}
+
+// IsAllowedHost returns true if the hostname matches the proxy rules or the
+// allowed hosts of the sni-proxy
+func (s *SNIProxy) IsAllowedHost(name string, rules DNSResolveList) bool {
+	if rule := rules.MatchDNS(name); rule != nil && rule.IsProxy() {
+		return true
+	}
+	for _, host := range s.AllowedHosts {
+		if MatchName(host, name) {
+			return true
+		}
+	}
+	return false
 }
 
 // AllowedPorts returns all the open ports for server
@@ -80,11 +119,22 @@ func (s *SNIProxy) AllowedPorts() []int {
 // DefaultSNIProxy configuration
 func DefaultSNIProxy() *SNIProxy {
 	p := &SNIProxy{
-		Host:        "127.0.0.1",
-		Ports:       []string{"0-10000"},
-		ConnTimeout: time.Second * 20,
-		DialTimeout: time.Second * 10,
-		DataTimeout: time.Second * 240,
+		Host:          "127.0.0.1",
+		Ports:         []string{"0-10000"},
+		ConnTimeout:   time.Second * 20,
+		DialTimeout:   time.Second * 10,
+		DataTimeout:   time.Second * 240,
+		AllowedHosts:  make([]string, 0),
+		Egress:        make([]*Egress, 0),
+		DefaultEgress: EgressDirect,
+		Sources:       make([]*Source, 0),
+		Resolver:      DefaultResolver(),
+		ProxyProtocol: DefaultProxyProtocol(),
+		Limits:        DefaultLimits(),
+		Traffic:       DefaultTraffic(),
+		AccessLog:     DefaultAccessLog(),
+		Fingerprints:  DefaultFingerprints(),
+		ECH:           DefaultECH(),
 	}
 	if host, ok := ip.FromEnv(); ok {
 		p.Host = host.String()
@@ -0,0 +1,93 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"fmt"
+	"net"
+)
+
+// Defines the versions of PROXY protocol header sent to destinations
+const (
+	ProxyProtocolV1 = "v1"
+	ProxyProtocolV2 = "v2"
+)
+
+// ProxyProtocol configuration of the sni-proxy
+type ProxyProtocol struct {
+	// TrustedCIDRs lists the networks of the load balancers in front of the
+	// sni-proxy, connections from them must start with a PROXY protocol header
+	TrustedCIDRs []string `yaml:"trusted_cidrs"`
+	// Send sets the version of the PROXY protocol header sent to destinations,
+	// no header is sent when it is empty
+	Send string `yaml:"send"`
+}
+
+// DefaultProxyProtocol generates default settings for PROXY protocol
+func DefaultProxyProtocol() *ProxyProtocol {
+	return &ProxyProtocol{
+		TrustedCIDRs: make([]string, 0),
+	}
+}
+
+// UnmarshalYAML rejects an invalid trusted network or an unknown version
+func (p *ProxyProtocol) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain ProxyProtocol
+	if err := unmarshal((*plain)(p)); err != nil {
+		return err
+	}
+	for _, cidr := range p.TrustedCIDRs {
+		if parseCIDR(cidr) == nil {
+			return fmt.Errorf("invalid trusted cidr %q", cidr)
+		}
+	}
+	switch p.Send {
+	case "", ProxyProtocolV1, ProxyProtocolV2:
+	default:
+		return fmt.Errorf("invalid proxy protocol version %q", p.Send)
+	}
+	return nil
+}
+
+// parseCIDR parses the network, a single address is a network of its own
+func parseCIDR(cidr string) *net.IPNet {
+	if _, block, err := net.ParseCIDR(cidr); err == nil {
+		return block
+	}
+	ip := net.ParseIP(cidr)
+	if ip == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+}
+
+// IsTrusted returns true if the address belongs to a trusted network, the
+// invalid entries are skipped
+func (p *ProxyProtocol) IsTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range p.TrustedCIDRs {
+		if block := parseCIDR(cidr); block != nil && block.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchName(t *testing.T) {
+	assert.True(t, config.MatchName("netflix.com", "netflix.com"))
+	assert.True(t, config.MatchName("netflix.com", "www.netflix.com."))
+	assert.True(t, config.MatchName("netflix.com.", "WWW.Netflix.com"))
+	assert.True(t, config.MatchName("", "netflix.com"))
+	assert.False(t, config.MatchName("netflix.com", "notnetflix.com"))
+	assert.False(t, config.MatchName("www.netflix.com", "netflix.com"))
+}
+
+func TestIsAllowedHost(t *testing.T) {
+	rules := config.DNSResolveList{
+		config.ResolveWithProxy("netflix.com", 60),
+		config.ResolveWithNameserver("api.netflix.com", "1.1.1.1", 60),
+		config.ResolveToIP("example.com", "1.2.3.4", 60),
+	}
+	p := config.DefaultSNIProxy()
+	p.AllowedHosts = []string{"disneyplus.com"}
+
+	assert.True(t, p.IsAllowedHost("www.netflix.com", rules))
+	assert.True(t, p.IsAllowedHost("www.disneyplus.com", rules))
+	assert.False(t, p.IsAllowedHost("api.netflix.com", rules))
+	assert.False(t, p.IsAllowedHost("example.com", rules))
+	assert.False(t, p.IsAllowedHost("127.0.0.1", rules))
+}
+
+func TestFingerprints(t *testing.T) {
+	const (
+		chrome = "t13d1516h2_8daaf6152771_e5627efa2ab1"
+		curl   = "t13d3112h2_e8f1e7e78f70_b26ce05bbdd6"
+	)
+	f := config.DefaultFingerprints()
+	allowed, entry := f.Match("ada70206e40642a3e4461f35503241d5", chrome)
+	assert.True(t, allowed)
+	assert.Empty(t, entry)
+
+	f.Denied = []string{"t13d3112h2_*_*", "ADA70206E40642A3E4461F35503241D5"}
+	allowed, entry = f.Match("", curl)
+	assert.False(t, allowed)
+	assert.Equal(t, "t13d3112h2_*_*", entry)
+	allowed, entry = f.Match("ada70206e40642a3e4461f35503241d5", chrome)
+	assert.False(t, allowed)
+	assert.Equal(t, "ADA70206E40642A3E4461F35503241D5", entry)
+
+	f.Denied = nil
+	f.Allowed = []string{"t13d1516h2_8daaf6152771_*"}
+	allowed, entry = f.Match("", chrome)
+	assert.True(t, allowed)
+	assert.Equal(t, "t13d1516h2_8daaf6152771_*", entry)
+	allowed, _ = f.Match("", curl)
+	assert.False(t, allowed)
+	assert.False(t, config.MatchFingerprint("t13d1516h2_*", "", chrome))
+}
+
+func TestProxyProtocolTrusted(t *testing.T) {
+	conf, err := config.Read([]byte("proxy:\n  proxy_protocol:\n    trusted_cidrs: [10.0.0.0/8, 192.168.1.1, \"fd00::/8\"]\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	p := conf.SNIProxy.ProxyProtocol
+	assert.True(t, p.IsTrusted(net.ParseIP("10.1.2.3")))
+	assert.True(t, p.IsTrusted(net.ParseIP("192.168.1.1")))
+	assert.True(t, p.IsTrusted(net.ParseIP("fd00::1")))
+	assert.False(t, p.IsTrusted(net.ParseIP("192.168.1.2")))
+	assert.False(t, p.IsTrusted(nil))
+
+	_, err = config.Read([]byte("proxy:\n  proxy_protocol:\n    trusted_cidrs: [10.0.0.0/33]\n"))
+	assert.Error(t, err)
+}
+
+func TestProxyProtocolInCode(t *testing.T) {
+	p := config.DefaultProxyProtocol()
+	assert.False(t, p.IsTrusted(net.ParseIP("10.1.2.3")))
+	p.TrustedCIDRs = append(p.TrustedCIDRs, "10.0.0.0/8", "invalid")
+	assert.True(t, p.IsTrusted(net.ParseIP("10.1.2.3")))
+	assert.False(t, p.IsTrusted(net.ParseIP("11.1.2.3")))
+}
+
+func TestProxyProtocolSend(t *testing.T) {
+	for _, send := range []string{"", "v1", "v2"} {
+		conf, err := config.Read([]byte("proxy:\n  proxy_protocol:\n    send: \"" + send + "\"\n"))
+		if assert.NoError(t, err, send) {
+			assert.Equal(t, send, conf.SNIProxy.ProxyProtocol.Send)
+		}
+	}
+	_, err := config.Read([]byte("proxy:\n  proxy_protocol:\n    send: v3\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,44 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+// QueryLog configuration of the dns query log
+type QueryLog struct {
+	Enabled bool `yaml:"enabled"`
+	// SampleRate is the fraction of the queries that are logged
+	SampleRate float64 `yaml:"sample_rate"`
+	// Anonymize truncates the client addresses to the prefix lengths
+	Anonymize     bool `yaml:"anonymize"`
+	IPv4PrefixLen int  `yaml:"ipv4_prefix_len"`
+	IPv6PrefixLen int  `yaml:"ipv6_prefix_len"`
+	// QueueSize is the number of entries waiting to be written, the
+	// entries are dropped when the sinks are too slow to keep up
+	QueueSize int     `yaml:"queue_size"`
+	Sinks     []*Sink `yaml:"sinks"`
+}
+
+// DefaultQueryLog generates default settings for the dns query log
+func DefaultQueryLog() *QueryLog {
+	return &QueryLog{
+		Enabled:       false,
+		SampleRate:    1,
+		IPv4PrefixLen: 24,
+		IPv6PrefixLen: 48,
+		QueueSize:     4096,
+		Sinks:         []*Sink{{Type: SinkStdout}},
+	}
+}
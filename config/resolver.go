@@ -0,0 +1,44 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import "time"
+
+// Defines the address family preferences of the resolver
+const (
+	PreferIPv4 = "ipv4"
+	PreferIPv6 = "ipv6"
+)
+
+// Resolver configuration of the upstream nameservers that the sni-proxy
+// resolves destinations with
+type Resolver struct {
+	Nameservers []string      `yaml:"nameservers"`
+	Prefer      string        `yaml:"prefer"`
+	Timeout     time.Duration `yaml:"timeout"`
+	CacheSize   int           `yaml:"cache_size"`
+}
+
+// DefaultResolver generates default settings for the upstream resolver
+func DefaultResolver() *Resolver {
+	return &Resolver{
+		Nameservers: []string{"8.8.8.8"},
+		Prefer:      PreferIPv4,
+		Timeout:     time.Second * 5,
+		CacheSize:   4096,
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/go-yaml/yaml"
+)
+
+// The dns rules, the network lists and the allowed hosts can be changed while
+// the servers are running. The changes replace the slices and the network
+// instead of modifying them, so the values returned by the accessors below
+// can be used without holding the lock.
+
+// Rules returns the dns rules, the list must not be modified
+func (c *Config) Rules() DNSResolveList {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.DNS.DNSResolveList
+}
+
+// Net returns the network lists, the network must not be modified
+func (c *Config) Net() *Network {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Network
+}
+
+// IsAllowedIP checks if the ip is allowed to make requests to this server
+func (c *Config) IsAllowedIP(s interface{}) bool {
+	return c.Net().IsAllowedIP(s)
+}
+
+// IsAllowedHost returns true if the hostname is allowed to be proxied
+func (c *Config) IsAllowedHost(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.SNIProxy.IsAllowedHost(name, c.DNS.DNSResolveList)
+}
+
+// AddRule adds the dns rule, replacing the rule with the same name
+func (c *Config) AddRule(rule *DNSResolve) error {
+	if rule == nil || len(rule.Name) == 0 || !rule.IsValid() {
+		return errors.New("invalid dns rule")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := make([]*DNSResolve, 0, len(c.DNS.DNSResolveList)+1)
+	for _, o := range c.DNS.DNSResolveList {
+		if !sameName(o.Name, rule.Name) {
+			list = append(list, o)
+		}
+	}
+	c.DNS.DNSResolveList = append(list, rule)
+	return nil
+}
+
+// RemoveRule removes the dns rule with the name, it returns false if there
+// is no such rule
+func (c *Config) RemoveRule(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := make([]*DNSResolve, 0, len(c.DNS.DNSResolveList))
+	for _, o := range c.DNS.DNSResolveList {
+		if !sameName(o.Name, name) {
+			list = append(list, o)
+		}
+	}
+	if len(list) == len(c.DNS.DNSResolveList) {
+		return false
+	}
+	c.DNS.DNSResolveList = list
+	return true
+}
+
+// AllowIP adds the ip to the allowed list of the network
+func (c *Config) AllowIP(ip net.IP) {
+	c.updateNetwork(func(n *Network) {
+		n.AllowedIPs = addIP(n.AllowedIPs, ip)
+	})
+}
+
+// BlockIP adds the ip to the blocked list of the network
+func (c *Config) BlockIP(ip net.IP) {
+	c.updateNetwork(func(n *Network) {
+		n.BlockedIPs = addIP(n.BlockedIPs, ip)
+	})
+}
+
+// RemoveAllowedIP removes the ip from the allowed list of the network, it
+// returns false if the ip is not in the list
+func (c *Config) RemoveAllowedIP(ip net.IP) bool {
+	var ok bool
+	c.updateNetwork(func(n *Network) {
+		n.AllowedIPs, ok = removeIP(n.AllowedIPs, ip)
+	})
+	return ok
+}
+
+// RemoveBlockedIP removes the ip from the blocked list of the network, it
+// returns false if the ip is not in the list
+func (c *Config) RemoveBlockedIP(ip net.IP) bool {
+	var ok bool
+	c.updateNetwork(func(n *Network) {
+		n.BlockedIPs, ok = removeIP(n.BlockedIPs, ip)
+	})
+	return ok
+}
+
+func (c *Config) updateNetwork(fn func(n *Network)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := *c.Network
+	fn(&n)
+	c.Network = &n
+}
+
+// Reload applies the dns rules, the network lists and the allowed hosts of
+// the configuration, the other settings take effect on restart
+func (c *Config) Reload(o *Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.DNS.DNSResolveList = o.DNS.DNSResolveList
+	c.Network = o.Network
+	c.SNIProxy.AllowedHosts = o.SNIProxy.AllowedHosts
+}
+
+// Save writes the dns rules and the network lists to the configuration file,
+// the file is replaced atomically. The other settings of the file are kept as
+// they were written, though not its comments.
+func (c *Config) Save() error {
+	if len(c.Path) == 0 {
+		return errors.New("configuration path is not set")
+	}
+	var doc yaml.MapSlice
+	src, err := ioutil.ReadFile(c.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	doc = setKey(doc, c.DNS.DNSResolveList, "dns", "resolve_dns")
+	doc = setKey(doc, c.Network.AllowedIPs, "network", "allowed_ips")
+	doc = setKey(doc, c.Network.BlockedIPs, "network", "blocked_ips")
+	c.mu.RUnlock()
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(c.Path), filepath.Base(c.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), c.Path); err != nil {
+		return fmt.Errorf("could not replace configuration: %v", err)
+	}
+	return nil
+}
+
+// setKey sets the value at the path of keys in the document, the missing
+// mappings on the path are added
+func setKey(m yaml.MapSlice, v interface{}, path ...string) yaml.MapSlice {
+	for i := range m {
+		if k, ok := m[i].Key.(string); !ok || k != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			m[i].Value = v
+		} else {
+			child, _ := m[i].Value.(yaml.MapSlice)
+			m[i].Value = setKey(child, v, path[1:]...)
+		}
+		return m
+	}
+	if len(path) == 1 {
+		return append(m, yaml.MapItem{Key: path[0], Value: v})
+	}
+	return append(m, yaml.MapItem{Key: path[0], Value: setKey(nil, v, path[1:]...)})
+}
+
+func sameName(a, b string) bool {
+	return fqdn(a) == fqdn(b)
+}
+
+func addIP(list []net.IP, ip net.IP) []net.IP {
+	for _, o := range list {
+		if o.Equal(ip) {
+			return list
+		}
+	}
+	o := make([]net.IP, len(list), len(list)+1)
+	copy(o, list)
+	return append(o, ip)
+}
+
+func removeIP(list []net.IP, ip net.IP) ([]net.IP, bool) {
+	o := make([]net.IP, 0, len(list))
+	for _, a := range list {
+		if !a.Equal(ip) {
+			o = append(o, a)
+		}
+	}
+	return o, len(o) < len(list)
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smartdns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "smartdns.yaml")
+	src := "dns:\n  tls:\n    email: ops@example.com\n" +
+		"  resolve_dns:\n  - name: hulu.com\n    nameserver: \"-\"\n" +
+		"admin:\n  token: ${ADMIN_TOKEN}\n"
+	assert.NoError(t, ioutil.WriteFile(path, []byte(src), 0644))
+
+	conf, err := config.FromFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, conf.AddRule(config.ResolveWithProxy("netflix.com", 60)))
+	conf.AllowIP(net.ParseIP("10.0.0.1"))
+	assert.NoError(t, conf.Save())
+
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	saved := string(b)
+	assert.Contains(t, saved, "email: ops@example.com")
+	assert.Contains(t, saved, "token: ${ADMIN_TOKEN}")
+	for _, key := range []string{"path:", "proxy:", "metrics:", "log:"} {
+		assert.NotContains(t, saved, key)
+	}
+
+	o, err := config.FromFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, conf.Rules(), o.Rules())
+		assert.True(t, o.IsAllowedIP("10.0.0.1"))
+		assert.False(t, o.IsAllowedIP("10.0.0.2"))
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/samuelngs/smartdns/log"
+)
+
+// Defines the types of the log sinks
+const (
+	SinkStdout = "stdout"
+	SinkStderr = "stderr"
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+	SinkDNSTap = "dnstap"
+	// SinkJournald sends the entries to systemd-journald, Path is the
+	// socket of the journal
+	SinkJournald = "journald"
+)
+
+// Sink configuration of a log output
+type Sink struct {
+	Type string `yaml:"type"`
+	// Path is the file of the file and dnstap sinks
+	Path string `yaml:"path,omitempty"`
+	// MaxSize is the size in megabytes the file is rotated at, MaxBackups
+	// is the number of rotated files kept and MaxAge is how long they are
+	// kept. Compress compresses the rotated files with gzip.
+	MaxSize    int           `yaml:"max_size,omitempty"`
+	MaxBackups int           `yaml:"max_backups,omitempty"`
+	MaxAge     time.Duration `yaml:"max_age,omitempty"`
+	Compress   bool          `yaml:"compress,omitempty"`
+	// Network and Address of the syslog daemon, the local daemon is used
+	// when the address is empty
+	Network string `yaml:"network,omitempty"`
+	Address string `yaml:"address,omitempty"`
+	Tag     string `yaml:"tag,omitempty"`
+}
+
+// Open opens the sink of the entries written as text
+func (s *Sink) Open() (log.Sink, error) {
+	switch s.Type {
+	case SinkStdout:
+		return log.Stdout(), nil
+	case SinkStderr:
+		return log.Stderr(), nil
+	case SinkFile:
+		return log.NewRotatingFileSink(s.Path, log.FileOptions{
+			MaxSize:    int64(s.MaxSize) << 20,
+			MaxBackups: s.MaxBackups,
+			MaxAge:     s.MaxAge,
+			Compress:   s.Compress,
+		})
+	case SinkSyslog:
+		return log.NewSyslogSink(s.Network, s.Address, s.Tag)
+	case SinkJournald:
+		return log.NewJournalSink(s.Path)
+	}
+	return nil, fmt.Errorf("unsupported sink type %q", s.Type)
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import "net"
+
+// Defines the strategies of picking a source address
+const (
+	SourceRoundRobin = "round-robin"
+	SourceSticky     = "sticky"
+)
+
+// Source configuration of the local addresses and network interface that
+// outbound connections are bound to
+type Source struct {
+	Name      string   `yaml:"name"`
+	Addresses []net.IP `yaml:"addresses"`
+	Interface string   `yaml:"interface,omitempty"`
+	Strategy  string   `yaml:"strategy,omitempty"`
+}
+
+// IsValid returns true if the source configuration is valid
+func (s *Source) IsValid() bool {
+	switch {
+	case len(s.Name) == 0:
+		return false
+	case len(s.Addresses) == 0 && len(s.Interface) == 0:
+		return false
+	}
+	switch s.Strategy {
+	case "", SourceRoundRobin, SourceSticky:
+		return true
+	}
+	return false
+}
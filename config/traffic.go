@@ -0,0 +1,79 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import "net"
+
+// Defines the behaviours when a traffic quota is exhausted
+const (
+	QuotaRefuse   = "refuse"
+	QuotaThrottle = "throttle"
+)
+
+// Traffic configuration of the bandwidth shaping and traffic quotas of the
+// sni-proxy, rates are in bytes per second and quotas are in bytes, a zero
+// value disables the limit
+type Traffic struct {
+	// ConnRate limits the rate of every proxied connection
+	ConnRate int64 `yaml:"conn_rate"`
+	// ClientRate and the quotas apply to every client that is not a
+	// registered user, they are accounted by the client address
+	ClientRate   int64 `yaml:"client_rate"`
+	DailyQuota   int64 `yaml:"daily_quota"`
+	MonthlyQuota int64 `yaml:"monthly_quota"`
+	// OnExhausted sets whether new connections are refused or the traffic is
+	// throttled to ThrottleRate once a quota is exhausted
+	OnExhausted  string `yaml:"on_exhausted"`
+	ThrottleRate int64  `yaml:"throttle_rate"`
+	// StateFile persists the traffic accounted in the current periods
+	StateFile string  `yaml:"state_file"`
+	Users     []*User `yaml:"users"`
+}
+
+// User configuration of a registered user, the traffic of all its addresses
+// is accounted together
+type User struct {
+	Name         string   `yaml:"name"`
+	IPs          []net.IP `yaml:"ips"`
+	Rate         int64    `yaml:"rate"`
+	DailyQuota   int64    `yaml:"daily_quota"`
+	MonthlyQuota int64    `yaml:"monthly_quota"`
+}
+
+// DefaultTraffic generates default settings for traffic shaping
+func DefaultTraffic() *Traffic {
+	return &Traffic{
+		OnExhausted:  QuotaRefuse,
+		ThrottleRate: 64 << 10,
+		Users:        make([]*User, 0),
+	}
+}
+
+// MatchUser returns the registered user that owns the address
+func (t *Traffic) MatchUser(ip net.IP) *User {
+	for _, user := range t.Users {
+		if user == nil {
+			continue
+		}
+		for _, o := range user.IPs {
+			if o.Equal(ip) {
+				return user
+			}
+		}
+	}
+	return nil
+}
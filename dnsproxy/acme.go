@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/log"
 	"golang.org/x/crypto/acme"
 )
 
@@ -39,25 +40,37 @@ type session struct {
 
 type acmeclient struct {
 	*acme.Client
-	conf *config.Config
+	conf       *config.Config
+	registered bool
 }
 
 func letsencrypt(ctx context.Context) *acmeclient {
 	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		logger.Fatal(err.Error())
+		logger.Fatal("could not generate acme account key", log.Error(err))
 	}
 	c := &acme.Client{
 		Key:          k,
 		DirectoryURL: "https://acme-v02.api.letsencrypt.org/directory",
 	}
-	_, err = c.Register(ctx, &acme.Account{}, func(_ string) bool {
+	return &acmeclient{Client: c}
+}
+
+// register creates the acme account, it is only done when dns-over-tls is
+// enabled so that an unreachable acme server does not stop the plain dns
+// server
+func (d *acmeclient) register(ctx context.Context) error {
+	if d.registered {
+		return nil
+	}
+	_, err := d.Register(ctx, &acme.Account{}, func(_ string) bool {
 		return true
 	})
 	if err != nil {
-		logger.Fatal(err.Error())
+		return fmt.Errorf("could not register acme account: %s", err)
 	}
-	return &acmeclient{Client: c}
+	d.registered = true
+	return nil
 }
 
 func (d *acmeclient) withConfig(conf *config.Config) {
@@ -68,6 +81,9 @@ func (d *acmeclient) initDNS01Challenge(ctx context.Context) (*session, error) {
 	if !d.conf.DNS.TLS.Enabled {
 		return nil, errors.New("dns-over-tls is disabled")
 	}
+	if err := d.register(ctx); err != nil {
+		return nil, err
+	}
 
 	ss := new(session)
 	authz, err := d.Authorize(ctx, d.conf.DNS.TLS.Hostname)
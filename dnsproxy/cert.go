@@ -0,0 +1,71 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"crypto/x509"
+	"sync"
+	"time"
+)
+
+// Defines the states of the dns-over-tls certificate
+const (
+	CertDisabled = "disabled"
+	CertPending  = "pending"
+	CertIssued   = "issued"
+	CertFailed   = "failed"
+)
+
+// CertStatus describes the certificate of the dns-over-tls listener
+type CertStatus struct {
+	State    string    `json:"state"`
+	Hostname string    `json:"hostname"`
+	NotAfter time.Time `json:"not_after,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type certState struct {
+	mu     sync.Mutex
+	status CertStatus
+}
+
+func (c *certState) set(status CertStatus) {
+	c.mu.Lock()
+	c.status = status
+	c.mu.Unlock()
+}
+
+func (c *certState) get() CertStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+func (c *certState) failed(hostname string, err error) {
+	c.set(CertStatus{State: CertFailed, Hostname: hostname, Error: err.Error()})
+}
+
+// issued records the expiry of the leaf certificate of the chain
+func (c *certState) issued(hostname string, der [][]byte) {
+	status := CertStatus{State: CertIssued, Hostname: hostname}
+	if len(der) > 0 {
+		if cert, err := x509.ParseCertificate(der[0]); err == nil {
+			status.NotAfter = cert.NotAfter
+		}
+	}
+	c.set(status)
+}
@@ -19,16 +19,23 @@ package dnsproxy
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/miekg/dns"
 	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/dnstap"
 	"github.com/samuelngs/smartdns/log"
 )
 
 type dnsServer struct {
 	*dns.Server
-	txt  *sync.Map
-	conf *config.Config
+	txt      *sync.Map
+	conf     *config.Config
+	limiter  *rateLimiter
+	recent   *queryRing
+	history  *nameHistory
+	queryLog *queryLog
+	dnstap   *dnstap.Output
 }
 
 func (d *dnsServer) parseQuery(r *dns.Msg) (dns.Question, bool) {
@@ -40,14 +47,19 @@ func (d *dnsServer) parseQuery(r *dns.Msg) (dns.Question, bool) {
 			if q.Qtype == dns.TypeTXT {
 				return q, true
 			}
+			if q.Qtype == typeHTTPS {
+				return q, true
+			}
 		}
 	}
 	return dns.Question{}, false
 }
 
-func (d *dnsServer) resolveA(m *dns.Msg, question dns.Question) {
-	list := config.DNSResolveList(d.conf.DNS.DNSResolveList)
-	resolv := list.MatchDNS(question.Name)
+func (d *dnsServer) resolveA(m *dns.Msg, question dns.Question, q *QueryInfo) {
+	resolv := d.conf.Rules().MatchDNS(question.Name)
+	if resolv != nil {
+		q.Rule = resolv.Name
+	}
 
 	var ttl = 60
 	if resolv != nil && resolv.TTL != ttl && resolv.TTL > 0 {
@@ -56,24 +68,29 @@ func (d *dnsServer) resolveA(m *dns.Msg, question dns.Question) {
 
 	switch {
 	case resolv != nil && resolv.Nameserver == "-":
-		logger.Trace(
-			"resolving domain name to proxy ip",
-			log.String("name", question.Name),
-			log.String("ip", d.conf.SNIProxy.Host))
+		if logger.Enabled(log.LogTrace) {
+			logger.Trace(
+				"resolving domain name to proxy ip",
+				log.String("name", question.Name),
+				log.String("ip", d.conf.SNIProxy.Host))
+		}
 
 		r, _ := dns.NewRR(fmt.Sprintf("%s %d IN A %s", question.Name, ttl, d.conf.SNIProxy.Host))
 		m.Answer = []dns.RR{r}
+		q.Action = actionProxy
 
 	case resolv != nil && len(resolv.Nameserver) > 0:
-		logger.Trace(
-			"resolving domain name with nameserver",
-			log.String("name", question.Name),
-			log.String("nameserver", resolv.Nameserver))
+		if logger.Enabled(log.LogTrace) {
+			logger.Trace(
+				"resolving domain name with nameserver",
+				log.String("name", question.Name),
+				log.String("nameserver", resolv.Nameserver))
+		}
 
+		q.Action, q.Upstream = actionNameserver, resolv.NameserverAddr()
 		t := new(dns.Msg)
 		t.SetQuestion(question.Name, dns.TypeA)
-		c := new(dns.Client)
-		if in, _, _ := c.Exchange(t, resolv.NameserverAddr()); len(in.Answer) > 0 {
+		if in, err := d.exchange(t, q.Upstream); err == nil {
 			for _, a := range in.Answer {
 				r, _ := dns.NewRR(a.String())
 				m.Answer = append(m.Answer, r)
@@ -81,23 +98,28 @@ func (d *dnsServer) resolveA(m *dns.Msg, question dns.Question) {
 		}
 
 	case resolv != nil && len(resolv.IP) > 0:
-		logger.Trace(
-			"resolving domain name to ip",
-			log.String("name", question.Name),
-			log.String("ip", resolv.IP))
+		if logger.Enabled(log.LogTrace) {
+			logger.Trace(
+				"resolving domain name to ip",
+				log.String("name", question.Name),
+				log.String("ip", resolv.IP))
+		}
 
 		r, _ := dns.NewRR(fmt.Sprintf("%s %d IN A %s", question.Name, ttl, resolv.IP))
 		m.Answer = []dns.RR{r}
+		q.Action = actionIP
 
 	default:
-		logger.Trace(
-			"resolving domain name with google nameserver",
-			log.String("name", question.Name))
+		if logger.Enabled(log.LogTrace) {
+			logger.Trace(
+				"resolving domain name with google nameserver",
+				log.String("name", question.Name))
+		}
 
+		q.Action, q.Upstream = actionUpstream, "8.8.8.8:53"
 		t := new(dns.Msg)
 		t.SetQuestion(question.Name, dns.TypeA)
-		c := new(dns.Client)
-		if in, _, _ := c.Exchange(t, "8.8.8.8:53"); len(in.Answer) > 0 {
+		if in, err := d.exchange(t, q.Upstream); err == nil {
 			for _, a := range in.Answer {
 				r, _ := dns.NewRR(a.String())
 				m.Answer = append(m.Answer, r)
@@ -114,28 +136,92 @@ func (d *dnsServer) resolveTXT(m *dns.Msg, question dns.Question) {
 }
 
 func (d *dnsServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	defer logger.Trace("dns query completed")
+
+	if !d.limiter.allowQuery(w.RemoteAddr()) {
+		rateLimitedTotal.WithLabelValues(d.Net, "query-limited").Inc()
+		if logger.Enabled(log.LogTrace) {
+			logger.Trace(
+				"dns query dropped by rate limit",
+				log.Addr("remote-addr", w.RemoteAddr()))
+		}
+		return
+	}
+
+	start := time.Now()
+	tcp := d.Net != "udp"
+	d.tap(dnstap.ClientQuery, r, tcp, w.RemoteAddr(), w.LocalAddr(), start, time.Time{})
+	q := &QueryInfo{
+		Time:     start,
+		Client:   addrIP(w.RemoteAddr()).String(),
+		Protocol: d.Net,
+		addr:     w.RemoteAddr(),
+		query:    r,
+	}
+	if len(r.Question) > 0 {
+		q.Name = r.Question[0].Name
+	}
+	defer func() {
+		q.Duration = time.Since(start).Seconds()
+		d.recent.add(*q)
+		if q.Action == actionProxy {
+			d.history.add(q.Client, q.Name, start)
+		}
+		d.queryLog.add(q)
+	}()
+
 	m := new(dns.Msg)
 	m.Compress = false
 	m.SetReply(r)
-	defer w.WriteMsg(m)
-	defer logger.Trace("dns query completed")
+	d.resolve(w, r, m, q)
+	q.Type, q.Rcode, q.Answers = qtypeString(r), rcodeString(m), answers(m)
+	queriesTotal.WithLabelValues(q.Type, q.Action, q.Rcode).Inc()
+
+	switch d.limiter.checkResponse(w.RemoteAddr(), m) {
+	case verdictDrop:
+		rateLimitedTotal.WithLabelValues(d.Net, "response-dropped").Inc()
+		if logger.Enabled(log.LogTrace) {
+			logger.Trace(
+				"dns response dropped by rate limit",
+				log.Addr("remote-addr", w.RemoteAddr()))
+		}
+		return
+	case verdictSlip:
+		// a truncated response asks the client to retry over tcp
+		rateLimitedTotal.WithLabelValues(d.Net, "response-slipped").Inc()
+		m.Truncated = true
+		m.Answer, m.Ns, m.Extra = nil, nil, nil
+	}
+	w.WriteMsg(m)
+	q.response = m
+	d.tap(dnstap.ClientResponse, m, tcp, w.RemoteAddr(), w.LocalAddr(), start, time.Now())
+}
 
-	if !d.conf.Network.IsAllowedIP(w.RemoteAddr()) {
+// resolve answers the query and records the action taken for it
+func (d *dnsServer) resolve(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg, q *QueryInfo) {
+	if !d.conf.IsAllowedIP(w.RemoteAddr()) {
+		q.Action = actionRefused
 		return
 	}
 	question, ok := d.parseQuery(r)
 	if !ok {
+		q.Action = actionUnsupported
 		return
 	}
 
-	logger.Trace(
-		"dns query accepted",
-		log.String("name", question.Name))
+	if logger.Enabled(log.LogTrace) {
+		logger.Trace(
+			"dns query accepted",
+			log.String("name", question.Name))
+	}
 
 	switch question.Qtype {
 	case dns.TypeA:
-		d.resolveA(m, question)
+		d.resolveA(m, question, q)
 	case dns.TypeTXT:
+		q.Action = actionTXT
 		d.resolveTXT(m, question)
+	case typeHTTPS:
+		d.resolveHTTPS(m, question, q)
 	}
 }
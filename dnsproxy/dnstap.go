@@ -0,0 +1,75 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/dnstap"
+)
+
+// newTap creates the dnstap output, it returns nil if dnstap is disabled
+func newTap(conf *config.DNSTap) *dnstap.Output {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+	return dnstap.NewOutput(conf.Network, conf.Address, conf.Identity, conf.QueueSize, conf.Timeout)
+}
+
+// tap queues the message for the dnstap output, the dns message is only
+// packed when dnstap is enabled
+func (d *dnsServer) tap(typ dnstap.MessageType, m *dns.Msg, tcp bool, qaddr, raddr net.Addr, qtime, rtime time.Time) {
+	if d.dnstap == nil || m == nil {
+		return
+	}
+	b, err := m.Pack()
+	if err != nil {
+		return
+	}
+	msg := &dnstap.Message{
+		Type:         typ,
+		TCP:          tcp,
+		QueryAddr:    qaddr,
+		ResponseAddr: raddr,
+		QueryTime:    qtime,
+		ResponseTime: rtime,
+	}
+	if typ == dnstap.ClientQuery || typ == dnstap.ForwarderQuery {
+		msg.Query = b
+	} else {
+		msg.Response = b
+	}
+	d.dnstap.Write(msg)
+}
+
+// nameserverAddr returns the address of the nameserver if it is an ip address
+func nameserverAddr(ns string) net.Addr {
+	host, port, err := net.SplitHostPort(ns)
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	n, err := strconv.Atoi(port)
+	if ip == nil || err != nil {
+		return nil
+	}
+	return &net.UDPAddr{IP: ip, Port: n}
+}
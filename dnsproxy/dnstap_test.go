@@ -0,0 +1,77 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/dnstap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExchangeTap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnstap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		rr, _ := dns.NewRR("netflix.com. 60 IN A 10.0.0.1")
+		m.Answer = []dns.RR{rr}
+		w.WriteMsg(m)
+	})}
+	go upstream.ActivateAndServe()
+	defer upstream.Shutdown()
+
+	conf := config.DefaultDNSTap()
+	conf.Enabled = true
+	conf.Network = dnstap.NetworkFile
+	conf.Address = filepath.Join(dir, "forwarder.tap")
+	d := &dnsServer{dnstap: newTap(conf)}
+
+	m := new(dns.Msg)
+	m.SetQuestion("netflix.com.", dns.TypeA)
+	in, err := d.exchange(m, pc.LocalAddr().String())
+	assert.NoError(t, err)
+	d.dnstap.Close()
+
+	b, err := ioutil.ReadFile(conf.Address)
+	assert.NoError(t, err)
+	query, _ := m.Pack()
+	response, _ := in.Pack()
+	assert.True(t, bytes.Contains(b, query))
+	assert.True(t, bytes.Contains(b, response))
+	assert.Equal(t, uint64(0), d.dnstap.Dropped())
+
+	assert.Nil(t, newTap(config.DefaultDNSTap()))
+	assert.Equal(t, &net.UDPAddr{IP: net.ParseIP("8.8.8.8"), Port: 53}, nameserverAddr("8.8.8.8:53"))
+	assert.Nil(t, nameserverAddr("dns.google:53"))
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defines the bounds of the history of the names resolved to the proxy
+const (
+	historyNames   = 16
+	historyClients = 4096
+)
+
+// nameHistory keeps the names each client resolved to the proxy within the
+// window, the sni-proxy looks them up to route the connections whose
+// ClientHello is encrypted
+type nameHistory struct {
+	mu      sync.Mutex
+	window  time.Duration
+	clients map[string][]resolvedName
+}
+
+type resolvedName struct {
+	name string
+	time time.Time
+}
+
+func newNameHistory(window time.Duration) *nameHistory {
+	return &nameHistory{window: window, clients: make(map[string][]resolvedName)}
+}
+
+// add records the name the client resolved at the time
+func (h *nameHistory) add(client, name string, now time.Time) {
+	if h == nil {
+		return
+	}
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	names, ok := h.clients[client]
+	if !ok && len(h.clients) >= historyClients {
+		h.evict(now)
+	}
+	o := make([]resolvedName, 0, historyNames)
+	for _, n := range names {
+		if n.name != name && now.Sub(n.time) < h.window {
+			o = append(o, n)
+		}
+	}
+	if len(o) == historyNames {
+		o = o[1:]
+	}
+	h.clients[client] = append(o, resolvedName{name, now})
+}
+
+// evict removes the clients without a name in the window and, if there are
+// still too many, the ones that resolved a name the longest ago so that the
+// next clients are added without evicting again
+func (h *nameHistory) evict(now time.Time) {
+	lasts := make([]time.Time, 0, len(h.clients))
+	for client, names := range h.clients {
+		last := names[len(names)-1].time
+		if now.Sub(last) >= h.window {
+			delete(h.clients, client)
+			continue
+		}
+		lasts = append(lasts, last)
+	}
+	excess := len(h.clients) - historyClients*7/8
+	if excess <= 0 {
+		return
+	}
+	sort.Slice(lasts, func(i, j int) bool { return lasts[i].Before(lasts[j]) })
+	cutoff := lasts[excess-1]
+	for client, names := range h.clients {
+		if !names[len(names)-1].time.After(cutoff) {
+			delete(h.clients, client)
+		}
+	}
+}
+
+// names returns the names the client resolved since the time, the latest
+// first
+func (h *nameHistory) names(client string, since time.Time) []string {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	names := h.clients[client]
+	var o []string
+	for i := len(names) - 1; i >= 0 && !names[i].time.Before(since); i-- {
+		o = append(o, names[i].name)
+	}
+	return o
+}
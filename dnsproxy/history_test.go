@@ -0,0 +1,58 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNameHistory(t *testing.T) {
+	now := time.Now()
+	h := newNameHistory(time.Second * 30)
+	h.add("10.0.0.1", "old.com.", now.Add(-time.Minute))
+	h.add("10.0.0.1", "netflix.com.", now.Add(-time.Second*2))
+	h.add("10.0.0.1", "Hulu.com.", now.Add(-time.Second))
+	h.add("10.0.0.2", "other.com.", now)
+	h.add("10.0.0.1", "netflix.com.", now)
+
+	assert.Equal(t, []string{"netflix.com", "hulu.com"}, h.names("10.0.0.1", now.Add(-time.Second*30)))
+	assert.Equal(t, []string{"netflix.com"}, h.names("10.0.0.1", now))
+	assert.Empty(t, h.names("10.0.0.3", now.Add(-time.Second*30)))
+
+	// the names of a client are bounded
+	for i := 0; i < historyNames*2; i++ {
+		h.add("10.0.0.1", fmt.Sprintf("%d.com", i), now)
+	}
+	names := h.names("10.0.0.1", now.Add(-time.Second*30))
+	assert.Len(t, names, historyNames)
+	assert.Equal(t, fmt.Sprintf("%d.com", historyNames*2-1), names[0])
+
+	// the queries of other clients do not push the names of a client out
+	for i := 0; i < historyClients*2; i++ {
+		h.add(fmt.Sprintf("client-%d", i), "netflix.com", now.Add(-time.Second*10))
+	}
+	assert.True(t, len(h.clients) <= historyClients)
+	assert.Len(t, h.names("10.0.0.1", now.Add(-time.Second*30)), historyNames)
+
+	var none *nameHistory
+	none.add("10.0.0.1", "netflix.com", now)
+	assert.Nil(t, none.names("10.0.0.1", now))
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+
+	"github.com/miekg/dns"
+	"github.com/samuelngs/smartdns/log"
+)
+
+// typeHTTPS is the type of the HTTPS records of RFC 9460, they are handled
+// as records of an unknown type
+const typeHTTPS = 65
+
+// Defines the keys of the service parameters of the HTTPS records
+const (
+	svcParamMandatory = 0
+	svcParamIPv4Hint  = 4
+	svcParamECH       = 5
+	svcParamIPv6Hint  = 6
+)
+
+func (d *dnsServer) resolveHTTPS(m *dns.Msg, question dns.Question, q *QueryInfo) {
+	resolv := d.conf.Rules().MatchDNS(question.Name)
+	if resolv != nil {
+		q.Rule = resolv.Name
+	}
+
+	// the address hints of the names resolved to the proxy point to the
+	// services, and their ECH configs would hide the names from the proxy
+	var strip map[uint16]bool
+	switch {
+	case resolv != nil && resolv.Nameserver == "-":
+		q.Action, q.Upstream = actionProxy, "8.8.8.8:53"
+		strip = map[uint16]bool{svcParamIPv4Hint: true, svcParamIPv6Hint: true}
+		if ech := d.conf.SNIProxy.ECH; ech != nil && ech.StripDNS {
+			strip[svcParamECH] = true
+		}
+	case resolv != nil && len(resolv.Nameserver) > 0:
+		q.Action, q.Upstream = actionNameserver, resolv.NameserverAddr()
+	case resolv != nil && len(resolv.IP) > 0:
+		// the records would point the clients elsewhere than the ip
+		q.Action = actionIP
+		return
+	default:
+		q.Action, q.Upstream = actionUpstream, "8.8.8.8:53"
+	}
+
+	t := new(dns.Msg)
+	t.SetQuestion(question.Name, typeHTTPS)
+	in, err := d.exchange(t, q.Upstream)
+	if err != nil {
+		return
+	}
+	for _, a := range in.Answer {
+		if strip != nil {
+			if a, err = stripHTTPS(a, strip); err != nil {
+				logger.Debug(
+					"dropped malformed https record",
+					log.String("name", question.Name),
+					log.Error(err))
+				continue
+			}
+		}
+		m.Answer = append(m.Answer, a)
+	}
+}
+
+// stripHTTPS returns a copy of the HTTPS record without the service
+// parameters of the keys, the other records are returned as they are
+func stripHTTPS(rr dns.RR, keys map[uint16]bool) (dns.RR, error) {
+	u, ok := rr.(*dns.RFC3597)
+	if !ok || u.Hdr.Rrtype != typeHTTPS {
+		return rr, nil
+	}
+	b, err := hex.DecodeString(u.Rdata)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = stripSvcParams(b, keys); err != nil {
+		return nil, err
+	}
+	o := *u
+	o.Rdata = hex.EncodeToString(b)
+	return &o, nil
+}
+
+// stripSvcParams removes the parameters of the keys from the rdata of a
+// SVCB or HTTPS record, and the keys from the mandatory parameter
+func stripSvcParams(b []byte, keys map[uint16]bool) ([]byte, error) {
+	// the priority is followed by the uncompressed target name
+	off := 2
+	for {
+		if off >= len(b) {
+			return nil, errors.New("truncated target name")
+		}
+		l := int(b[off])
+		if l&0xc0 != 0 {
+			return nil, errors.New("compressed target name")
+		}
+		off += 1 + l
+		if l == 0 {
+			break
+		}
+	}
+	if off > len(b) {
+		return nil, errors.New("truncated target name")
+	}
+
+	o := append([]byte(nil), b[:off]...)
+	for off < len(b) {
+		if off+4 > len(b) {
+			return nil, errors.New("truncated service parameter")
+		}
+		key := binary.BigEndian.Uint16(b[off:])
+		end := off + 4 + int(binary.BigEndian.Uint16(b[off+2:]))
+		if end > len(b) {
+			return nil, errors.New("truncated service parameter")
+		}
+		switch {
+		case keys[key]:
+		case key == svcParamMandatory:
+			o = appendMandatory(o, b[off+4:end], keys)
+		default:
+			o = append(o, b[off:end]...)
+		}
+		off = end
+	}
+	return o, nil
+}
+
+// appendMandatory appends the mandatory parameter without the keys, it is
+// left out if no key remains
+func appendMandatory(o, value []byte, keys map[uint16]bool) []byte {
+	var kept []byte
+	for i := 0; i+2 <= len(value); i += 2 {
+		if !keys[binary.BigEndian.Uint16(value[i:])] {
+			kept = append(kept, value[i:i+2]...)
+		}
+	}
+	if len(kept) == 0 {
+		return o
+	}
+	o = append(o, 0, svcParamMandatory, byte(len(kept)>>8), byte(len(kept)))
+	return append(o, kept...)
+}
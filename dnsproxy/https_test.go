@@ -0,0 +1,88 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// svcParam builds a service parameter of the key with the value
+func svcParam(key uint16, value ...byte) []byte {
+	return append([]byte{byte(key >> 8), byte(key), byte(len(value) >> 8), byte(len(value))}, value...)
+}
+
+func TestStripSvcParams(t *testing.T) {
+	// priority 1, target "."
+	head := []byte{0, 1, 0}
+	alpn := svcParam(1, 2, 'h', '2')
+	rdata := append(append([]byte(nil), head...), svcParam(svcParamMandatory, 0, 1, 0, svcParamIPv4Hint)...)
+	rdata = append(rdata, alpn...)
+	rdata = append(rdata, svcParam(svcParamIPv4Hint, 1, 2, 3, 4)...)
+	rdata = append(rdata, svcParam(svcParamECH, 0xab, 0xcd)...)
+
+	keys := map[uint16]bool{svcParamIPv4Hint: true, svcParamECH: true}
+	b, err := stripSvcParams(rdata, keys)
+	if assert.NoError(t, err) {
+		want := append(append([]byte(nil), head...), svcParam(svcParamMandatory, 0, 1)...)
+		assert.Equal(t, append(want, alpn...), b)
+	}
+
+	// the mandatory parameter is removed when none of its keys remain
+	rdata = append(append([]byte(nil), head...), svcParam(svcParamMandatory, 0, svcParamECH)...)
+	rdata = append(rdata, svcParam(svcParamECH, 1)...)
+	b, err = stripSvcParams(rdata, keys)
+	if assert.NoError(t, err) {
+		assert.Equal(t, head, b)
+	}
+
+	for _, rdata := range [][]byte{
+		{0, 1},
+		{0, 1, 5, 'a'},
+		{0, 1, 0xc0, 0},
+		append(append([]byte(nil), head...), 0, 1, 0),
+		append(append([]byte(nil), head...), 0, 1, 0, 4, 'h'),
+	} {
+		_, err := stripSvcParams(rdata, keys)
+		assert.Error(t, err, "%x", rdata)
+	}
+}
+
+func TestStripHTTPS(t *testing.T) {
+	rdata := append([]byte{0, 1, 0}, svcParam(svcParamECH, 1)...)
+	rr := &dns.RFC3597{
+		Hdr:   dns.RR_Header{Name: "netflix.com.", Rrtype: typeHTTPS, Class: dns.ClassINET},
+		Rdata: hex.EncodeToString(rdata),
+	}
+	o, err := stripHTTPS(rr, map[uint16]bool{svcParamECH: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "000100", o.(*dns.RFC3597).Rdata)
+		assert.Equal(t, hex.EncodeToString(rdata), rr.Rdata)
+	}
+
+	a := &dns.A{Hdr: dns.RR_Header{Name: "netflix.com.", Rrtype: dns.TypeA}}
+	o, err = stripHTTPS(a, map[uint16]bool{svcParamECH: true})
+	assert.NoError(t, err)
+	assert.Equal(t, a, o)
+
+	rr.Rdata = "zz"
+	_, err = stripHTTPS(rr, map[uint16]bool{svcParamECH: true})
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/samuelngs/smartdns/dnstap"
+	"github.com/samuelngs/smartdns/metrics"
+)
+
+// Actions of the queries, the rule actions are named after the way the
+// matching rule resolves the name
+const (
+	actionProxy       = "proxy"
+	actionNameserver  = "nameserver"
+	actionIP          = "ip"
+	actionUpstream    = "upstream"
+	actionTXT         = "txt"
+	actionRefused     = "refused"
+	actionUnsupported = "unsupported"
+)
+
+var (
+	queriesTotal = metrics.NewCounterVec(
+		"smartdns_dns_queries_total",
+		"DNS queries answered by query type, action and response code.",
+		"qtype", "action", "rcode")
+	rateLimitedTotal = metrics.NewCounterVec(
+		"smartdns_dns_rate_limited_total",
+		"DNS queries and responses affected by the rate limits by listener.",
+		"listener", "verdict")
+	upstreamDuration = metrics.NewHistogramVec(
+		"smartdns_dns_upstream_duration_seconds",
+		"Latency of the queries sent to the upstream nameservers.",
+		metrics.DefBuckets,
+		"server")
+	upstreamErrors = metrics.NewCounterVec(
+		"smartdns_dns_upstream_errors_total",
+		"Queries to the upstream nameservers that failed.",
+		"server")
+)
+
+// exchange sends the query to the upstream nameserver, records its latency
+// and taps the forwarded query and response
+func (d *dnsServer) exchange(m *dns.Msg, ns string) (*dns.Msg, error) {
+	addr := nameserverAddr(ns)
+	start := time.Now()
+	d.tap(dnstap.ForwarderQuery, m, false, nil, addr, start, time.Time{})
+	in, _, err := new(dns.Client).Exchange(m, ns)
+	end := time.Now()
+	upstreamDuration.WithLabelValues(ns).Observe(end.Sub(start).Seconds())
+	if err != nil {
+		upstreamErrors.WithLabelValues(ns).Inc()
+		return in, err
+	}
+	d.tap(dnstap.ForwarderResponse, in, false, nil, addr, start, end)
+	return in, err
+}
+
+func qtypeString(r *dns.Msg) string {
+	if len(r.Question) == 0 {
+		return "none"
+	}
+	if s, ok := dns.TypeToString[r.Question[0].Qtype]; ok {
+		return s
+	}
+	if r.Question[0].Qtype == typeHTTPS {
+		return "HTTPS"
+	}
+	return "other"
+}
+
+func rcodeString(m *dns.Msg) string {
+	if s, ok := dns.RcodeToString[m.Rcode]; ok {
+		return s
+	}
+	return "other"
+}
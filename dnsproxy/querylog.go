@@ -0,0 +1,258 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/dnstap"
+	"github.com/samuelngs/smartdns/log"
+	"github.com/samuelngs/smartdns/metrics"
+)
+
+var queryLogDropped = metrics.NewCounterVec(
+	"smartdns_dns_query_log_dropped_total",
+	"Query log entries dropped because the sinks could not keep up.")
+
+// QueryInfo describes an answered dns query
+type QueryInfo struct {
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client"`
+	Protocol string    `json:"protocol"`
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	// Rule is the name of the dns rule that matched the query
+	Rule     string   `json:"rule,omitempty"`
+	Action   string   `json:"action"`
+	Upstream string   `json:"upstream,omitempty"`
+	Rcode    string   `json:"rcode"`
+	Answers  []string `json:"answers,omitempty"`
+	Duration float64  `json:"duration_seconds"`
+
+	addr     net.Addr
+	query    *dns.Msg
+	response *dns.Msg
+}
+
+// answers returns the data of the answer records
+func answers(m *dns.Msg) []string {
+	if len(m.Answer) == 0 {
+		return nil
+	}
+	o := make([]string, 0, len(m.Answer))
+	for _, rr := range m.Answer {
+		switch r := rr.(type) {
+		case *dns.A:
+			o = append(o, r.A.String())
+		case *dns.AAAA:
+			o = append(o, r.AAAA.String())
+		default:
+			o = append(o, strings.TrimPrefix(rr.String(), rr.Header().String()))
+		}
+	}
+	return o
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch o := addr.(type) {
+	case *net.UDPAddr:
+		return o.IP
+	case *net.TCPAddr:
+		return o.IP
+	}
+	return nil
+}
+
+// queryOutput writes the entries of the query log to a sink
+type queryOutput interface {
+	write(q *QueryInfo) error
+	Close() error
+}
+
+// jsonOutput writes the entries as json lines
+type jsonOutput struct {
+	log.Sink
+}
+
+func (o *jsonOutput) write(q *QueryInfo) error {
+	b, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	_, err = o.Write(append(b, '\n'))
+	return err
+}
+
+// dnstapOutput writes the client query and response of the entries as
+// dnstap messages
+type dnstapOutput struct {
+	*dnstap.Writer
+	identity []byte
+}
+
+func (o *dnstapOutput) write(q *QueryInfo) error {
+	tcp := q.Protocol != "udp"
+	if q.query != nil {
+		b, err := q.query.Pack()
+		if err != nil {
+			return err
+		}
+		m := &dnstap.Message{Type: dnstap.ClientQuery, TCP: tcp, QueryAddr: q.addr, QueryTime: q.Time, Query: b}
+		if err := o.WriteFrame(dnstap.Marshal(m, o.identity, []byte("smartdns"))); err != nil {
+			return err
+		}
+	}
+	if q.response != nil {
+		b, err := q.response.Pack()
+		if err != nil {
+			return err
+		}
+		end := q.Time.Add(time.Duration(q.Duration * float64(time.Second)))
+		m := &dnstap.Message{Type: dnstap.ClientResponse, TCP: tcp, QueryAddr: q.addr, QueryTime: q.Time, ResponseTime: end, Response: b}
+		return o.WriteFrame(dnstap.Marshal(m, o.identity, []byte("smartdns")))
+	}
+	return nil
+}
+
+func openQueryOutput(s *config.Sink) (queryOutput, error) {
+	if s.Type != config.SinkDNSTap {
+		sink, err := s.Open()
+		if err != nil {
+			return nil, err
+		}
+		return &jsonOutput{sink}, nil
+	}
+	w, err := dnstap.Create(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	identity, _ := os.Hostname()
+	return &dnstapOutput{Writer: w, identity: []byte(identity)}, nil
+}
+
+// queryLog writes the answered queries to the sinks in the background, the
+// queries are dropped rather than delaying the answers when the sinks are slow
+type queryLog struct {
+	conf    *config.QueryLog
+	queue   chan *QueryInfo
+	outputs []queryOutput
+	v4mask  net.IPMask
+	v6mask  net.IPMask
+	done    chan struct{}
+}
+
+// newQueryLog opens the sinks of the query log, it returns nil if the query
+// log is disabled or none of the sinks could be opened
+func newQueryLog(conf *config.QueryLog) *queryLog {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+	l := &queryLog{
+		conf:   conf,
+		v4mask: net.CIDRMask(conf.IPv4PrefixLen, 32),
+		v6mask: net.CIDRMask(conf.IPv6PrefixLen, 128),
+		done:   make(chan struct{}),
+	}
+	for _, s := range conf.Sinks {
+		o, err := openQueryOutput(s)
+		if err != nil {
+			logger.Warn(
+				"could not open query log sink",
+				log.String("type", s.Type),
+				log.Error(err))
+			continue
+		}
+		l.outputs = append(l.outputs, o)
+	}
+	if len(l.outputs) == 0 {
+		return nil
+	}
+	size := conf.QueueSize
+	if size <= 0 {
+		size = 1
+	}
+	l.queue = make(chan *QueryInfo, size)
+	go l.run()
+	return l
+}
+
+// add queues the query unless it is not sampled or the queue is full
+func (l *queryLog) add(q *QueryInfo) {
+	if l == nil {
+		return
+	}
+	if l.conf.SampleRate < 1 && rand.Float64() >= l.conf.SampleRate {
+		return
+	}
+	select {
+	case l.queue <- q:
+	default:
+		queryLogDropped.WithLabelValues().Inc()
+	}
+}
+
+func (l *queryLog) run() {
+	defer close(l.done)
+	for q := range l.queue {
+		if l.conf.Anonymize {
+			l.anonymize(q)
+		}
+		for _, o := range l.outputs {
+			if err := o.write(q); err != nil {
+				logger.Warn("could not write query log", log.Error(err))
+			}
+		}
+	}
+	for _, o := range l.outputs {
+		o.Close()
+	}
+}
+
+// anonymize truncates the client address to its network prefix
+func (l *queryLog) anonymize(q *QueryInfo) {
+	ip := addrIP(q.addr)
+	switch {
+	case ip == nil:
+		return
+	case ip.To4() != nil:
+		ip = ip.To4().Mask(l.v4mask)
+	default:
+		ip = ip.Mask(l.v6mask)
+	}
+	q.Client = ip.String()
+	if _, ok := q.addr.(*net.TCPAddr); ok {
+		q.addr = &net.TCPAddr{IP: ip}
+	} else {
+		q.addr = &net.UDPAddr{IP: ip}
+	}
+}
+
+// close writes the queued entries and closes the sinks
+func (l *queryLog) close() {
+	if l == nil {
+		return
+	}
+	close(l.queue)
+	<-l.done
+}
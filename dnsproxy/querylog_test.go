@@ -0,0 +1,129 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/dnstap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "querylog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := config.DefaultQueryLog()
+	conf.Enabled = true
+	conf.Anonymize = true
+	conf.Sinks = []*config.Sink{
+		{Type: config.SinkFile, Path: filepath.Join(dir, "queries.jsonl")},
+		{Type: config.SinkDNSTap, Path: filepath.Join(dir, "queries.tap")},
+	}
+	l := newQueryLog(conf)
+	if !assert.NotNil(t, l) {
+		return
+	}
+
+	r := new(dns.Msg)
+	r.SetQuestion("netflix.com.", dns.TypeA)
+	m := new(dns.Msg)
+	m.SetReply(r)
+	rr, _ := dns.NewRR("netflix.com. 60 IN A 10.0.0.1")
+	m.Answer = []dns.RR{rr}
+
+	addr := &net.UDPAddr{IP: net.ParseIP("198.51.100.7"), Port: 5353}
+	l.add(&QueryInfo{
+		Time:     time.Unix(1500000000, 0).UTC(),
+		Client:   addr.IP.String(),
+		Protocol: "udp",
+		Name:     "netflix.com.",
+		Type:     "A",
+		Rule:     "netflix.com",
+		Action:   actionProxy,
+		Rcode:    "NOERROR",
+		Answers:  answers(m),
+		addr:     addr,
+		query:    r,
+		response: m,
+	})
+	l.close()
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "queries.jsonl"))
+	assert.NoError(t, err)
+	var q map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &q))
+	assert.Equal(t, "198.51.100.0", q["client"])
+	assert.Equal(t, "netflix.com", q["rule"])
+	assert.Equal(t, []interface{}{"10.0.0.1"}, q["answers"])
+	assert.Equal(t, "2017-07-14T02:40:00Z", q["time"])
+
+	// the dnstap file holds the start frame, the query, the response and the
+	// stop frame
+	b, err = ioutil.ReadFile(filepath.Join(dir, "queries.tap"))
+	assert.NoError(t, err)
+	var frames, controls [][]byte
+	for len(b) >= 4 {
+		n := binary.BigEndian.Uint32(b)
+		if n == 0 {
+			n = binary.BigEndian.Uint32(b[4:])
+			controls = append(controls, b[8:8+n])
+			b = b[8+n:]
+			continue
+		}
+		frames = append(frames, b[4:4+n])
+		b = b[4+n:]
+	}
+	if assert.Len(t, controls, 2) {
+		assert.True(t, bytes.Contains(controls[0], []byte(dnstap.ContentType)))
+	}
+	if assert.Len(t, frames, 2) {
+		assert.True(t, bytes.Contains(frames[0], []byte{198, 51, 100, 0}))
+		packed, _ := m.Pack()
+		assert.True(t, bytes.Contains(frames[1], packed))
+	}
+}
+
+func TestQueryLogSampling(t *testing.T) {
+	conf := config.DefaultQueryLog()
+	conf.Enabled = true
+	conf.SampleRate = 0
+	conf.QueueSize = 1
+	l := newQueryLog(conf)
+	if !assert.NotNil(t, l) {
+		return
+	}
+	defer l.close()
+	for i := 0; i < 10; i++ {
+		l.add(&QueryInfo{})
+	}
+	assert.Len(t, l.queue, 0)
+	assert.Nil(t, newQueryLog(config.DefaultQueryLog()))
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/ratelimit"
+)
+
+// Stats contains the counters of a dns listener
+type Stats struct {
+	QueriesLimited   uint64
+	ResponsesDropped uint64
+	ResponsesSlipped uint64
+}
+
+// verdict of the response rate limiting
+type verdict int
+
+const (
+	verdictSend verdict = iota
+	verdictDrop
+	verdictSlip
+)
+
+// rateLimiter limits the queries of a network and the identical responses
+// sent to it, which keeps the server from being used for amplification
+type rateLimiter struct {
+	conf      *config.DNSRateLimit
+	queries   *ratelimit.Limiter
+	responses *ratelimit.Limiter
+	v4mask    net.IPMask
+	v6mask    net.IPMask
+
+	dropped          uint64
+	queriesLimited   uint64
+	responsesDropped uint64
+	responsesSlipped uint64
+}
+
+func newRateLimiter(conf *config.DNSRateLimit) *rateLimiter {
+	if conf == nil {
+		return nil
+	}
+	r := &rateLimiter{
+		conf:   conf,
+		v4mask: net.CIDRMask(conf.IPv4PrefixLen, 32),
+		v6mask: net.CIDRMask(conf.IPv6PrefixLen, 128),
+	}
+	if r.v4mask == nil {
+		r.v4mask = net.CIDRMask(32, 32)
+	}
+	if r.v6mask == nil {
+		r.v6mask = net.CIDRMask(128, 128)
+	}
+	if conf.QueriesPerSecond > 0 {
+		r.queries = ratelimit.NewLimiter(conf.QueriesPerSecond, burst(conf.QueryBurst, conf.QueriesPerSecond))
+	}
+	if conf.ResponsesPerSecond > 0 {
+		r.responses = ratelimit.NewLimiter(conf.ResponsesPerSecond, burst(0, conf.ResponsesPerSecond))
+	}
+	return r
+}
+
+func burst(n int, rate float64) int {
+	if n > 0 {
+		return n
+	}
+	return int(rate) + 1
+}
+
+// prefix returns the network of the address
+func (r *rateLimiter) prefix(addr net.Addr) string {
+	ip := addrIP(addr)
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(r.v4mask).String()
+	}
+	return ip.Mask(r.v6mask).String()
+}
+
+// allowQuery returns false if the network of the client sends queries over
+// the limit
+func (r *rateLimiter) allowQuery(addr net.Addr) bool {
+	if r == nil || r.queries == nil {
+		return true
+	}
+	if !r.queries.Allow(r.prefix(addr)) {
+		atomic.AddUint64(&r.queriesLimited, 1)
+		return false
+	}
+	return true
+}
+
+// checkResponse decides whether the response is sent, dropped or sent
+// truncated. Positive answers are limited per name and type, negative answers
+// and errors are limited per rcode so that random names are grouped together.
+func (r *rateLimiter) checkResponse(addr net.Addr, m *dns.Msg) verdict {
+	if r == nil || r.responses == nil {
+		return verdictSend
+	}
+	if _, ok := addr.(*net.UDPAddr); !ok {
+		return verdictSend
+	}
+
+	var key string
+	switch {
+	case m.Rcode == dns.RcodeSuccess && len(m.Answer) > 0 && len(m.Question) > 0:
+		q := m.Question[0]
+		key = fmt.Sprintf("%s|answer|%s|%d", r.prefix(addr), strings.ToLower(q.Name), q.Qtype)
+	default:
+		key = fmt.Sprintf("%s|rcode|%d", r.prefix(addr), m.Rcode)
+	}
+	if r.responses.Allow(key) {
+		return verdictSend
+	}
+
+	n := atomic.AddUint64(&r.dropped, 1)
+	if r.conf.Slip > 0 && n%uint64(r.conf.Slip) == 0 {
+		atomic.AddUint64(&r.responsesSlipped, 1)
+		return verdictSlip
+	}
+	atomic.AddUint64(&r.responsesDropped, 1)
+	return verdictDrop
+}
+
+func (r *rateLimiter) stats() Stats {
+	if r == nil {
+		return Stats{}
+	}
+	return Stats{
+		QueriesLimited:   atomic.LoadUint64(&r.queriesLimited),
+		ResponsesDropped: atomic.LoadUint64(&r.responsesDropped),
+		ResponsesSlipped: atomic.LoadUint64(&r.responsesSlipped),
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/samuelngs/smartdns/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterQueries(t *testing.T) {
+	r := newRateLimiter(&config.DNSRateLimit{QueriesPerSecond: 1, QueryBurst: 2, IPv4PrefixLen: 24})
+	a := &net.UDPAddr{IP: net.ParseIP("192.0.2.1")}
+	b := &net.UDPAddr{IP: net.ParseIP("192.0.2.200")}
+	c := &net.UDPAddr{IP: net.ParseIP("198.51.100.1")}
+
+	assert.True(t, r.allowQuery(a))
+	assert.True(t, r.allowQuery(b))
+	assert.False(t, r.allowQuery(a))
+	assert.True(t, r.allowQuery(c))
+	assert.Equal(t, uint64(1), r.stats().QueriesLimited)
+}
+
+func TestRateLimiterResponses(t *testing.T) {
+	r := newRateLimiter(&config.DNSRateLimit{ResponsesPerSecond: 1, Slip: 2, IPv4PrefixLen: 24})
+	addr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1")}
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	rr, _ := dns.NewRR("example.com. 60 IN A 192.0.2.10")
+	m.Answer = []dns.RR{rr}
+
+	assert.Equal(t, verdictSend, r.checkResponse(addr, m))
+	assert.Equal(t, verdictSend, r.checkResponse(addr, m))
+	assert.Equal(t, verdictDrop, r.checkResponse(addr, m))
+	assert.Equal(t, verdictSlip, r.checkResponse(addr, m))
+
+	// tcp responses are never limited
+	assert.Equal(t, verdictSend, r.checkResponse(&net.TCPAddr{IP: addr.IP}, m))
+	assert.Equal(t, Stats{ResponsesDropped: 1, ResponsesSlipped: 1}, r.stats())
+}
+
+func TestSlippedQueryRetriedOverTCP(t *testing.T) {
+	conf := config.DefaultConfig()
+	conf.DNS.RateLimit = &config.DNSRateLimit{ResponsesPerSecond: 1, Slip: 1}
+	assert.NoError(t, conf.AddRule(config.ResolveToIP("example.com", "192.0.2.10", 60)))
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDNSProxy(conf)
+	d.dns.Server = &dns.Server{PacketConn: pc, Net: "udp", Handler: d.dns}
+	d.dnstcp.Server = &dns.Server{Listener: l, Net: "tcp", Handler: d.dnstcp}
+	go d.dns.ActivateAndServe()
+	go d.dnstcp.ActivateAndServe()
+	defer d.dns.Shutdown()
+	defer d.dnstcp.Shutdown()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	var in *dns.Msg
+	for i := 0; i < 3; i++ {
+		in, _, err = new(dns.Client).Exchange(m, pc.LocalAddr().String())
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+	assert.True(t, in.Truncated)
+	assert.Empty(t, in.Answer)
+
+	in, _, err = (&dns.Client{Net: "tcp"}).Exchange(m, l.Addr().String())
+	if assert.NoError(t, err) {
+		assert.False(t, in.Truncated)
+		assert.Len(t, in.Answer, 1)
+	}
+}
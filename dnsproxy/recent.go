@@ -0,0 +1,63 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import "sync"
+
+// recentQueries is the number of queries kept for inspection
+const recentQueries = 512
+
+// queryRing keeps the latest queries, overwriting the oldest ones
+type queryRing struct {
+	mu   sync.Mutex
+	buf  []QueryInfo
+	next int
+	full bool
+}
+
+func newQueryRing(size int) *queryRing {
+	return &queryRing{buf: make([]QueryInfo, size)}
+}
+
+func (r *queryRing) add(q QueryInfo) {
+	q.query, q.response = nil, nil
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.next] = q
+	r.next++
+	if r.next == len(r.buf) {
+		r.next, r.full = 0, true
+	}
+}
+
+// list returns at most n queries, the latest first
+func (r *queryRing) list(n int) []QueryInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	size := r.next
+	if r.full {
+		size = len(r.buf)
+	}
+	if n <= 0 || n > size {
+		n = size
+	}
+	o := make([]QueryInfo, n)
+	for i := range o {
+		o[i] = r.buf[(r.next-1-i+len(r.buf))%len(r.buf)]
+	}
+	return o
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsproxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryRing(t *testing.T) {
+	r := newQueryRing(3)
+	assert.Empty(t, r.list(10))
+
+	for _, name := range []string{"a.", "b."} {
+		r.add(QueryInfo{Name: name})
+	}
+	assert.Equal(t, []QueryInfo{{Name: "b."}, {Name: "a."}}, r.list(0))
+
+	for _, name := range []string{"c.", "d.", "e."} {
+		r.add(QueryInfo{Name: name})
+	}
+	assert.Equal(t, []QueryInfo{{Name: "e."}, {Name: "d."}, {Name: "c."}}, r.list(10))
+	assert.Equal(t, []QueryInfo{{Name: "e."}, {Name: "d."}}, r.list(2))
+}
@@ -19,23 +19,32 @@ package dnsproxy
 import (
 	"context"
 	"crypto/tls"
+	"net"
 	"sync"
+	"time"
 
 	"github.com/miekg/dns"
 	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/dnstap"
 	"github.com/samuelngs/smartdns/log"
 	"golang.org/x/sync/errgroup"
 )
 
-var logger = log.DefaultLogger
+var logger = log.DefaultLogger.Named("dnsproxy")
 
 // DNSProxy constructs a dns-proxy server
 type DNSProxy struct {
-	conf   *config.Config
-	acme   *acmeclient
-	dns    *dnsServer
-	dnstls *dnsServer
-	ctx    context.Context
+	conf     *config.Config
+	acme     *acmeclient
+	dns      *dnsServer
+	dnstcp   *dnsServer
+	dnstls   *dnsServer
+	recent   *queryRing
+	history  *nameHistory
+	queryLog *queryLog
+	dnstap   *dnstap.Output
+	cert     *certState
+	ctx      context.Context
 }
 
 // Start initializes and starts dns-proxy server
@@ -43,7 +52,15 @@ func (d *DNSProxy) Start() error {
 	var eg errgroup.Group
 	logger.Debug("started accepting DNS queries")
 
+	switch network := d.conf.Net(); {
+	case network.IsOpen():
+		logger.Warn("network allow list is empty, DNS queries from any address are answered")
+	case len(network.AllowedIPs) == 0:
+		logger.Warn("network allow list is empty and default deny is set, all DNS queries are refused")
+	}
+
 	eg.Go(func() error { return d.dns.ListenAndServe() })
+	eg.Go(func() error { return d.dnstcp.ListenAndServe() })
 	eg.Go(d.startDOTServer)
 
 	return eg.Wait()
@@ -55,15 +72,29 @@ func (d *DNSProxy) Stop() error {
 	logger.Debug("stopped accepting DNS queries")
 
 	eg.Go(func() error { return d.dns.Shutdown() })
+	eg.Go(func() error { return d.dnstcp.Shutdown() })
 	eg.Go(func() error { return d.dnstls.Shutdown() })
 
-	return eg.Wait()
+	err := eg.Wait()
+	d.queryLog.close()
+	d.dnstap.Close()
+	return err
 }
 
 func (d *DNSProxy) startDOTServer() error {
+	hostname := d.conf.DNS.TLS.Hostname
+	if !d.conf.DNS.TLS.Enabled {
+		d.cert.set(CertStatus{State: CertDisabled, Hostname: hostname})
+	} else {
+		d.cert.set(CertStatus{State: CertPending, Hostname: hostname})
+	}
+
 	logger.Debug("initialize dns-01 challenge")
 	s, err := d.acme.initDNS01Challenge(d.ctx)
 	if err != nil {
+		if d.conf.DNS.TLS.Enabled {
+			d.cert.failed(hostname, err)
+		}
 		return err
 	}
 
@@ -76,42 +107,89 @@ func (d *DNSProxy) startDOTServer() error {
 
 	logger.Debug("start dns-01 verification")
 	if err := d.acme.startDNS01Challenge(d.ctx, s); err != nil {
+		d.cert.failed(hostname, err)
 		return err
 	}
 
 	logger.Debug("create acme certificate")
 	o, err := d.acme.createAcmeCert(d.ctx, s)
 	if err != nil {
+		d.cert.failed(hostname, err)
 		return err
 	}
 	if o == nil {
 		return nil
 	}
+	d.cert.issued(hostname, o)
 
 	d.dnstls.Shutdown()
 	d.dnstls.Server.TLSConfig = &tls.Config{}
 	return d.dnstls.ListenAndServe()
 }
 
+// Queries returns at most n of the latest queries, the latest first
+func (d *DNSProxy) Queries(n int) []QueryInfo {
+	return d.recent.list(n)
+}
+
+// RecentNames returns the names the client resolved to the proxy since the
+// time, the latest first. The names are only kept for the history policy of
+// the connections with an encrypted ClientHello.
+func (d *DNSProxy) RecentNames(client net.IP, since time.Time) []string {
+	return d.history.names(client.String(), since)
+}
+
+// Certificate returns the status of the dns-over-tls certificate
+func (d *DNSProxy) Certificate() CertStatus {
+	return d.cert.get()
+}
+
+// Stats returns the counters of the dns listeners by their address
+func (d *DNSProxy) Stats() map[string]Stats {
+	return map[string]Stats{
+		d.dns.Net + "/" + d.dns.Addr:       d.dns.limiter.stats(),
+		d.dnstls.Net + "/" + d.dnstls.Addr: d.dnstls.limiter.stats(),
+	}
+}
+
 // NewDNSProxy creates a dns-proxy server
 func NewDNSProxy(conf *config.Config) *DNSProxy {
 	m := new(sync.Map)
+	q := newQueryRing(recentQueries)
+	l := newQueryLog(conf.DNS.QueryLog)
+	o := newTap(conf.DNS.DNSTap)
 	c := context.Background()
 
+	var h *nameHistory
+	if ech := conf.SNIProxy.ECH; ech != nil && ech.Policy == config.ECHHistory {
+		h = newNameHistory(ech.HistoryWindow)
+	}
+
 	a := letsencrypt(c)
 	a.withConfig(conf)
 
-	r := &dnsServer{conf: conf, txt: m}
+	r := &dnsServer{conf: conf, txt: m, recent: q, history: h, queryLog: l, dnstap: o, limiter: newRateLimiter(conf.DNS.RateLimit)}
 	r.Server = &dns.Server{Addr: ":53", Net: "udp", Handler: r}
 
-	t := &dnsServer{conf: conf, txt: m}
+	// the clients retry over tcp when a rate limited response is truncated,
+	// the listener shares the limits of the udp one
+	p := &dnsServer{conf: conf, txt: m, recent: q, history: h, queryLog: l, dnstap: o, limiter: r.limiter}
+	p.Server = &dns.Server{Addr: ":53", Net: "tcp", Handler: p}
+
+	t := &dnsServer{conf: conf, txt: m, recent: q, history: h, queryLog: l, dnstap: o, limiter: newRateLimiter(conf.DNS.TLS.RateLimit)}
 	t.Server = &dns.Server{Addr: ":853", Net: "tcp", Handler: t}
 
 	return &DNSProxy{
-		conf:   conf,
-		acme:   a,
-		dns:    r,
-		dnstls: t,
-		ctx:    c,
+		conf:     conf,
+		acme:     a,
+		dns:      r,
+		dnstcp:   p,
+		dnstls:   t,
+		recent:   q,
+		history:  h,
+		queryLog: l,
+		dnstap:   o,
+		cert:     new(certState),
+		ctx:      c,
 	}
 }
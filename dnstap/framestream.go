@@ -0,0 +1,201 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnstap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ContentType identifies the dnstap payloads of a Frame Stream
+const ContentType = "protobuf:dnstap.Dnstap"
+
+// control frame types
+const (
+	controlAccept = 0x01
+	controlStart  = 0x02
+	controlStop   = 0x03
+	controlReady  = 0x04
+	controlFinish = 0x05
+
+	controlFieldContentType = 0x01
+)
+
+// maxControlSize bounds the control frames read from a collector
+const maxControlSize = 512
+
+// Writer writes the dnstap messages as a Frame Stream
+type Writer struct {
+	mu     sync.Mutex
+	w      io.WriteCloser
+	conn   net.Conn
+	closed bool
+}
+
+// NewWriter starts a Frame Stream on the writer
+func NewWriter(w io.WriteCloser) (*Writer, error) {
+	if err := writeControl(w, controlStart, ContentType); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// Dial connects to a collector listening on a unix socket or tcp address and
+// starts a bidirectional Frame Stream, the collector has to accept the
+// dnstap content type within the timeout
+func Dial(network, addr string, timeout time.Duration) (*Writer, error) {
+	c, err := net.DialTimeout(network, addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c.SetDeadline(time.Now().Add(timeout))
+	if err := handshake(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.SetDeadline(time.Time{})
+	return &Writer{w: c, conn: c}, nil
+}
+
+func handshake(c net.Conn) error {
+	if err := writeControl(c, controlReady, ContentType); err != nil {
+		return err
+	}
+	typ, types, err := readControl(c)
+	if err != nil {
+		return err
+	}
+	if typ != controlAccept {
+		return fmt.Errorf("dnstap: unexpected control frame %d", typ)
+	}
+	if !contains(types, ContentType) {
+		return errors.New("dnstap: content type was not accepted")
+	}
+	return writeControl(c, controlStart, ContentType)
+}
+
+// SetWriteDeadline sets the deadline of the next writes if the stream is
+// connected to a collector
+func (w *Writer) SetWriteDeadline(t time.Time) error {
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.SetWriteDeadline(t)
+}
+
+// WriteFrame writes the encoded message as a data frame
+func (w *Writer) WriteFrame(b []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errors.New("dnstap: write on closed stream")
+	}
+	frame := make([]byte, 4+len(b))
+	binary.BigEndian.PutUint32(frame, uint32(len(b)))
+	copy(frame[4:], b)
+	_, err := w.w.Write(frame)
+	return err
+}
+
+// Close stops the Frame Stream and closes the underlying writer
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := writeControl(w.w, controlStop, "")
+	if err == nil && w.conn != nil {
+		// the collector acknowledges the end of a bidirectional stream
+		w.conn.SetDeadline(time.Now().Add(time.Second))
+		if typ, _, rerr := readControl(w.conn); rerr != nil {
+			err = rerr
+		} else if typ != controlFinish {
+			err = fmt.Errorf("dnstap: unexpected control frame %d", typ)
+		}
+	}
+	if cerr := w.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeControl writes a control frame with an optional content type
+func writeControl(w io.Writer, typ uint32, contentType string) error {
+	size := 4
+	if len(contentType) > 0 {
+		size += 8 + len(contentType)
+	}
+	b := make([]byte, 8+size)
+	binary.BigEndian.PutUint32(b[4:], uint32(size))
+	binary.BigEndian.PutUint32(b[8:], typ)
+	if len(contentType) > 0 {
+		binary.BigEndian.PutUint32(b[12:], controlFieldContentType)
+		binary.BigEndian.PutUint32(b[16:], uint32(len(contentType)))
+		copy(b[20:], contentType)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// readControl reads a control frame and returns its type and content types
+func readControl(r io.Reader) (uint32, []string, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	if binary.BigEndian.Uint32(hdr[:4]) != 0 {
+		return 0, nil, errors.New("dnstap: expected a control frame")
+	}
+	size := binary.BigEndian.Uint32(hdr[4:])
+	if size < 4 || size > maxControlSize {
+		return 0, nil, fmt.Errorf("dnstap: invalid control frame size %d", size)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+	typ, b := binary.BigEndian.Uint32(b), b[4:]
+	var types []string
+	for len(b) >= 8 {
+		field, n := binary.BigEndian.Uint32(b), binary.BigEndian.Uint32(b[4:])
+		b = b[8:]
+		if uint32(len(b)) < n {
+			return 0, nil, errors.New("dnstap: truncated control field")
+		}
+		if field == controlFieldContentType {
+			types = append(types, string(b[:n]))
+		}
+		b = b[n:]
+	}
+	return typ, types, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, o := range list {
+		if o == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnstap_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/smartdns/dnstap"
+	"github.com/stretchr/testify/assert"
+)
+
+// readFrame reads a frame, the type of a control frame is returned with its
+// payload
+func readFrame(r io.Reader) (uint32, []byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return 0, nil, err
+	}
+	control := n == 0
+	if control {
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return 0, nil, err
+		}
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+	if !control {
+		return 0, b, nil
+	}
+	return binary.BigEndian.Uint32(b), b[4:], nil
+}
+
+func writeControl(w io.Writer, typ uint32, contentType string) {
+	b := make([]byte, 20+len(contentType))
+	binary.BigEndian.PutUint32(b[4:], uint32(12+len(contentType)))
+	binary.BigEndian.PutUint32(b[8:], typ)
+	binary.BigEndian.PutUint32(b[12:], 1)
+	binary.BigEndian.PutUint32(b[16:], uint32(len(contentType)))
+	copy(b[20:], contentType)
+	w.Write(b)
+}
+
+// collect accepts a bidirectional Frame Stream and returns the control frame
+// types and the data frames it received
+func collect(t *testing.T, l net.Listener) <-chan [][]byte {
+	out := make(chan [][]byte, 1)
+	go func() {
+		defer close(out)
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		var frames [][]byte
+		for {
+			typ, b, err := readFrame(c)
+			if err != nil {
+				out <- frames
+				return
+			}
+			switch typ {
+			case 0x04:
+				assert.True(t, bytes.Contains(b, []byte(dnstap.ContentType)))
+				writeControl(c, 0x01, dnstap.ContentType)
+			case 0x03:
+				writeControl(c, 0x05, "")
+				out <- frames
+				return
+			case 0:
+				frames = append(frames, b)
+			}
+		}
+	}()
+	return out
+}
+
+func TestOutputSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnstap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dnstap.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	frames := collect(t, l)
+
+	o := dnstap.NewOutput(dnstap.NetworkUnix, path, "ns1", 16, time.Second)
+	for _, typ := range []dnstap.MessageType{dnstap.ForwarderQuery, dnstap.ForwarderResponse} {
+		o.Write(&dnstap.Message{Type: typ, QueryTime: time.Now(), Query: []byte("query")})
+	}
+	o.Close()
+
+	received := <-frames
+	if assert.Len(t, received, 2) {
+		assert.True(t, bytes.Contains(received[0], []byte("ns1")))
+		assert.True(t, bytes.Contains(received[1], []byte("query")))
+	}
+	assert.Equal(t, uint64(0), o.Dropped())
+}
+
+func TestOutputUnreachable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnstap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the messages are dropped while the collector is down and the writes
+	// never block
+	o := dnstap.NewOutput(dnstap.NetworkUnix, filepath.Join(dir, "missing.sock"), "", 1, time.Second)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		o.Write(&dnstap.Message{Type: dnstap.ClientQuery})
+	}
+	assert.True(t, time.Since(start) < time.Second)
+	o.Close()
+	assert.Equal(t, uint64(100), o.Dropped())
+}
+
+func TestCreateKeepsCaptures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnstap")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dnstap.fstrm")
+
+	var frames []string
+	for i := 0; i < 8; i++ {
+		frames = append(frames, fmt.Sprint("capture ", i))
+		w, err := dnstap.Create(path)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, w.WriteFrame([]byte(frames[i])))
+		assert.NoError(t, w.Close())
+	}
+
+	files, err := filepath.Glob(path + "*")
+	assert.NoError(t, err)
+	assert.Len(t, files, 6)
+	for i, name := range []string{"", ".1", ".2", ".3", ".4", ".5"} {
+		b, err := ioutil.ReadFile(path + name)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		r := bytes.NewReader(b)
+		typ, _, err := readFrame(r)
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(0x02), typ)
+		_, data, err := readFrame(r)
+		assert.NoError(t, err)
+		assert.Equal(t, frames[len(frames)-1-i], string(data))
+	}
+}
+
+func TestDialRejected(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		readFrame(c)
+		writeControl(c, 0x01, "protobuf:other")
+	}()
+
+	_, err = dnstap.Dial("tcp", l.Addr().String(), time.Second)
+	assert.Error(t, err)
+}
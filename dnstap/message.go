@@ -0,0 +1,178 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dnstap encodes dns messages in the dnstap format and writes them as
+// Frame Streams, see https://dnstap.info
+package dnstap
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// MessageType is the point of the resolution the message was captured at
+type MessageType int
+
+// Defines the message types used by smartdns
+const (
+	ClientQuery       MessageType = 5
+	ClientResponse    MessageType = 6
+	ForwarderQuery    MessageType = 7
+	ForwarderResponse MessageType = 8
+)
+
+// Defines the socket families and protocols
+const (
+	familyInet  = 1
+	familyInet6 = 2
+
+	protocolUDP = 1
+	protocolTCP = 2
+)
+
+// dnstapMessage is the type of the dnstap envelope holding a message
+const dnstapMessage = 1
+
+// Message is a dns message captured by the server
+type Message struct {
+	Type MessageType
+	// TCP is true if the message was sent over a stream transport
+	TCP bool
+	// QueryAddr is the address of the side that sent the query, the
+	// response address is the other side
+	QueryAddr    net.Addr
+	ResponseAddr net.Addr
+	QueryTime    time.Time
+	ResponseTime time.Time
+	// Query and Response are the dns messages in wire format
+	Query    []byte
+	Response []byte
+}
+
+// Marshal encodes the message in a dnstap protobuf envelope
+func Marshal(m *Message, identity, version []byte) []byte {
+	var msg []byte
+	msg = appendVarintField(msg, 1, uint64(m.Type))
+
+	qip, qport := splitAddr(m.QueryAddr)
+	rip, rport := splitAddr(m.ResponseAddr)
+	ip := qip
+	if ip == nil {
+		ip = rip
+	}
+	if ip != nil {
+		if ip.To4() != nil {
+			msg = appendVarintField(msg, 2, familyInet)
+		} else {
+			msg = appendVarintField(msg, 2, familyInet6)
+		}
+	}
+	if m.TCP {
+		msg = appendVarintField(msg, 3, protocolTCP)
+	} else {
+		msg = appendVarintField(msg, 3, protocolUDP)
+	}
+	if qip != nil {
+		msg = appendBytesField(msg, 4, ipBytes(qip))
+	}
+	if rip != nil {
+		msg = appendBytesField(msg, 5, ipBytes(rip))
+	}
+	if qip != nil {
+		msg = appendVarintField(msg, 6, uint64(qport))
+	}
+	if rip != nil {
+		msg = appendVarintField(msg, 7, uint64(rport))
+	}
+	if !m.QueryTime.IsZero() {
+		msg = appendVarintField(msg, 8, uint64(m.QueryTime.Unix()))
+		msg = appendFixed32Field(msg, 9, uint32(m.QueryTime.Nanosecond()))
+	}
+	if m.Query != nil {
+		msg = appendBytesField(msg, 10, m.Query)
+	}
+	if !m.ResponseTime.IsZero() {
+		msg = appendVarintField(msg, 12, uint64(m.ResponseTime.Unix()))
+		msg = appendFixed32Field(msg, 13, uint32(m.ResponseTime.Nanosecond()))
+	}
+	if m.Response != nil {
+		msg = appendBytesField(msg, 14, m.Response)
+	}
+
+	var b []byte
+	if len(identity) > 0 {
+		b = appendBytesField(b, 1, identity)
+	}
+	if len(version) > 0 {
+		b = appendBytesField(b, 2, version)
+	}
+	b = appendBytesField(b, 14, msg)
+	b = appendVarintField(b, 15, dnstapMessage)
+	return b
+}
+
+func splitAddr(addr net.Addr) (net.IP, int) {
+	switch o := addr.(type) {
+	case *net.UDPAddr:
+		return o.IP, o.Port
+	case *net.TCPAddr:
+		return o.IP, o.Port
+	}
+	return nil, 0
+}
+
+func ipBytes(ip net.IP) []byte {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendTag(b []byte, field, wire int) []byte {
+	return appendVarint(b, uint64(field<<3|wire))
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	return appendVarint(appendTag(b, field, wireVarint), v)
+}
+
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = appendVarint(appendTag(b, field, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendFixed32Field(b []byte, field int, v uint32) []byte {
+	b = appendTag(b, field, wireFixed32)
+	var o [4]byte
+	binary.LittleEndian.PutUint32(o[:], v)
+	return append(b, o[:]...)
+}
@@ -0,0 +1,200 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnstap
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/samuelngs/smartdns/log"
+	"github.com/samuelngs/smartdns/metrics"
+)
+
+var logger = log.DefaultLogger.Named("dnstap")
+
+var droppedTotal = metrics.NewCounterVec(
+	"smartdns_dnstap_dropped_total",
+	"dnstap messages dropped because the output was slow or disconnected.")
+
+// Defines the networks of the outputs
+const (
+	NetworkUnix = "unix"
+	NetworkTCP  = "tcp"
+	NetworkFile = "file"
+)
+
+// reconnect delays of an output that could not be opened
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Second * 30
+)
+
+// maxBackups is the number of previous captures kept next to a file output
+const maxBackups = 5
+
+// Create creates the file and starts a unidirectional Frame Stream on it, a
+// previous capture at the path is moved to path.1 so that each file holds a
+// single stream, the older ones are shifted up to path.5 and the oldest is
+// removed
+func Create(path string) (*Writer, error) {
+	if fi, err := os.Stat(path); err == nil && fi.Size() > 0 {
+		os.Remove(backup(path, maxBackups))
+		for i := maxBackups - 1; i > 0; i-- {
+			os.Rename(backup(path, i), backup(path, i+1))
+		}
+		if err := os.Rename(path, backup(path, 1)); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func backup(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Output writes the messages to a collector or a file in the background, the
+// messages are dropped rather than blocking the caller when the queue is full
+// or the collector is unreachable
+type Output struct {
+	network  string
+	address  string
+	timeout  time.Duration
+	identity []byte
+	version  []byte
+	queue    chan *Message
+	done     chan struct{}
+	dropped  uint64
+}
+
+// NewOutput creates an output to the address of the network, which is a
+// collector listening on a unix socket or a tcp address, or a file whose
+// previous captures are kept as described in Create
+func NewOutput(network, address, identity string, size int, timeout time.Duration) *Output {
+	if size <= 0 {
+		size = 1
+	}
+	if len(identity) == 0 {
+		identity, _ = os.Hostname()
+	}
+	o := &Output{
+		network:  network,
+		address:  address,
+		timeout:  timeout,
+		identity: []byte(identity),
+		version:  []byte("smartdns"),
+		queue:    make(chan *Message, size),
+		done:     make(chan struct{}),
+	}
+	go o.run()
+	return o
+}
+
+// Write queues the message without blocking
+func (o *Output) Write(m *Message) {
+	if o == nil {
+		return
+	}
+	select {
+	case o.queue <- m:
+	default:
+		o.drop()
+	}
+}
+
+// Dropped returns the number of messages that were not written
+func (o *Output) Dropped() uint64 {
+	return atomic.LoadUint64(&o.dropped)
+}
+
+// Close writes the queued messages and stops the Frame Stream
+func (o *Output) Close() {
+	if o == nil {
+		return
+	}
+	close(o.queue)
+	<-o.done
+}
+
+func (o *Output) drop() {
+	atomic.AddUint64(&o.dropped, 1)
+	droppedTotal.WithLabelValues().Inc()
+}
+
+func (o *Output) open() (*Writer, error) {
+	if o.network == NetworkFile {
+		return Create(o.address)
+	}
+	return Dial(o.network, o.address, o.timeout)
+}
+
+func (o *Output) run() {
+	defer close(o.done)
+
+	var w *Writer
+	var retry time.Time
+	backoff := minBackoff
+	for m := range o.queue {
+		if w == nil {
+			if time.Now().Before(retry) {
+				o.drop()
+				continue
+			}
+			var err error
+			if w, err = o.open(); err != nil {
+				logger.Warn(
+					"could not open dnstap output",
+					log.String("network", o.network),
+					log.String("address", o.address),
+					log.Error(err))
+				retry = time.Now().Add(backoff)
+				if backoff *= 2; backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+				o.drop()
+				continue
+			}
+			backoff = minBackoff
+		}
+		if o.timeout > 0 {
+			w.SetWriteDeadline(time.Now().Add(o.timeout))
+		}
+		if err := w.WriteFrame(Marshal(m, o.identity, o.version)); err != nil {
+			logger.Warn(
+				"could not write dnstap message",
+				log.String("address", o.address),
+				log.Error(err))
+			w.Close()
+			w = nil
+			o.drop()
+		}
+	}
+	if w != nil {
+		w.Close()
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/samuelngs/smartdns/metrics"
+)
+
+// maxBatchSize is the size the queued entries are merged up to before they
+// are written to the sink
+const maxBatchSize = 64 << 10
+
+var droppedTotal = metrics.NewCounterVec(
+	"smartdns_log_dropped_total",
+	"log entries dropped because the output was slower than the logging calls.")
+
+// asyncEntry is a queued entry or a request to sync the sink
+type asyncEntry struct {
+	b    *[]byte
+	sync chan error
+}
+
+// AsyncSink writes the entries to a sink from a goroutine, the entries are
+// dropped rather than blocking the logging calls when the queue is full
+type AsyncSink struct {
+	sink    Sink
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan asyncEntry
+	done    chan struct{}
+	dropped uint64
+}
+
+// NewAsyncSink returns a sink that queues up to size entries for the sink
+func NewAsyncSink(sink Sink, size int) *AsyncSink {
+	if size <= 0 {
+		size = 1
+	}
+	s := &AsyncSink{
+		sink:  sink,
+		queue: make(chan asyncEntry, size),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write queues a copy of the entry without blocking, the entry is dropped
+// if the queue is full
+func (s *AsyncSink) Write(b []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, os.ErrClosed
+	}
+	buf := getBuffer()
+	*buf = append(*buf, b...)
+	select {
+	case s.queue <- asyncEntry{b: buf}:
+	default:
+		putBuffer(buf)
+		atomic.AddUint64(&s.dropped, 1)
+		droppedTotal.WithLabelValues().Inc()
+	}
+	return len(b), nil
+}
+
+// Dropped returns the number of entries that were not written
+func (s *AsyncSink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Sync waits for the queued entries to be written and syncs the sink, the
+// error of the writes since the last sync is returned
+func (s *AsyncSink) Sync() error {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return nil
+	}
+	ch := make(chan error, 1)
+	s.queue <- asyncEntry{sync: ch}
+	s.mu.RUnlock()
+	return <-ch
+}
+
+// Close writes the queued entries and closes the sink
+func (s *AsyncSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+	<-s.done
+	return s.sink.Close()
+}
+
+func (s *AsyncSink) run() {
+	defer close(s.done)
+
+	var err error
+	batch := make([]byte, 0, maxBatchSize)
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if _, werr := s.sink.Write(batch); werr != nil && err == nil {
+			err = werr
+		}
+		batch = batch[:0]
+	}
+	for e := range s.queue {
+		// the entries already queued are merged into one write
+		for {
+			if e.sync != nil {
+				write()
+				if sy, ok := s.sink.(Syncer); ok {
+					if serr := sy.Sync(); serr != nil && err == nil {
+						err = serr
+					}
+				}
+				e.sync <- err
+				err = nil
+			} else {
+				if len(batch)+len(*e.b) > maxBatchSize {
+					write()
+				}
+				batch = append(batch, *e.b...)
+				putBuffer(e.b)
+			}
+			var ok bool
+			select {
+			case e, ok = <-s.queue:
+			default:
+			}
+			if !ok {
+				break
+			}
+		}
+		write()
+	}
+}
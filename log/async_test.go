@@ -0,0 +1,114 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/samuelngs/smartdns/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingSink holds the writes until it is released
+type blockingSink struct {
+	bufferSink
+	mu      sync.Mutex
+	entered chan struct{}
+	release chan struct{}
+	synced  int
+}
+
+func (s *blockingSink) Write(b []byte) (int, error) {
+	if s.entered != nil {
+		s.entered <- struct{}{}
+	}
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bufferSink.Write(b)
+}
+
+func (s *blockingSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.synced++
+	return nil
+}
+
+func (s *blockingSink) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bufferSink.String()
+}
+
+func TestAsyncSink(t *testing.T) {
+	out := &blockingSink{release: make(chan struct{})}
+	close(out.release)
+	s := log.NewAsyncSink(out, 16)
+
+	for i := 0; i < 10; i++ {
+		n, err := s.Write([]byte("entry\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, 6, n)
+	}
+	assert.NoError(t, s.Sync())
+	assert.Equal(t, strings.Repeat("entry\n", 10), out.String())
+	assert.Equal(t, 1, out.synced)
+	assert.Equal(t, uint64(0), s.Dropped())
+
+	assert.NoError(t, s.Close())
+	assert.NoError(t, s.Close())
+	_, err := s.Write([]byte("late\n"))
+	assert.Error(t, err)
+	assert.NoError(t, s.Sync())
+}
+
+func TestAsyncSinkDrops(t *testing.T) {
+	out := &blockingSink{entered: make(chan struct{}, 8), release: make(chan struct{})}
+	s := log.NewAsyncSink(out, 4)
+
+	// the writer blocks on the first entry and the queue holds four more
+	s.Write([]byte("first\n"))
+	<-out.entered
+	for i := 0; i < 20; i++ {
+		s.Write([]byte("entry\n"))
+	}
+	assert.Equal(t, uint64(16), s.Dropped())
+	close(out.release)
+	assert.NoError(t, s.Close())
+	assert.Equal(t, "first\n"+strings.Repeat("entry\n", 4), out.String())
+}
+
+func TestFlushDrainsAsyncOutputs(t *testing.T) {
+	defer log.SetFormat(log.EncoderConsole, false)
+
+	out := &blockingSink{release: make(chan struct{})}
+	close(out.release)
+	s := log.NewAsyncSink(out, 64)
+	defer s.Close()
+	log.SetOutputs(log.NewOutput(s, log.LogTrace, &log.LogfmtEncoder{}))
+
+	logger := log.NewLogger()
+	for i := 0; i < 32; i++ {
+		logger.Warn("queued", log.Int("n", i))
+	}
+	assert.NoError(t, log.Flush())
+	assert.Equal(t, 32, strings.Count(out.String(), "msg=queued"))
+	assert.Contains(t, out.String(), "n=31\n")
+}
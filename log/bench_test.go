@@ -0,0 +1,82 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/smartdns/log"
+)
+
+type discardSink struct{}
+
+func (discardSink) Write(b []byte) (int, error) {
+	return ioutil.Discard.Write(b)
+}
+
+func (discardSink) Close() error {
+	return nil
+}
+
+func benchmarkLogger(b *testing.B, level log.Level, sink log.Sink, e log.Encoder) {
+	defer log.SetFormat(log.EncoderConsole, false)
+	defer log.SetLevels(log.Levels())
+	log.SetLevel(level)
+	log.SetOutputs(log.NewOutput(sink, log.LogTrace, e))
+
+	err := errors.New("connection refused")
+	logger := log.NewLogger().Named("dnsproxy")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Trace("dns query accepted",
+			log.String("name", "netflix.com."),
+			log.Duration("elapsed", time.Millisecond),
+			log.Error(err))
+	}
+	b.StopTimer()
+	log.Flush()
+}
+
+func BenchmarkDisabled(b *testing.B) {
+	benchmarkLogger(b, log.LogInfo, discardSink{}, &log.LogfmtEncoder{})
+}
+
+func BenchmarkLogfmt(b *testing.B) {
+	benchmarkLogger(b, log.LogTrace, discardSink{}, &log.LogfmtEncoder{})
+}
+
+func BenchmarkLogfmtCaller(b *testing.B) {
+	benchmarkLogger(b, log.LogTrace, discardSink{}, &log.LogfmtEncoder{Caller: true})
+}
+
+func BenchmarkJSON(b *testing.B) {
+	benchmarkLogger(b, log.LogTrace, discardSink{}, &log.JSONEncoder{})
+}
+
+func BenchmarkLogfmtStderr(b *testing.B) {
+	benchmarkLogger(b, log.LogTrace, log.Stderr(), &log.LogfmtEncoder{})
+}
+
+func BenchmarkLogfmtStderrAsync(b *testing.B) {
+	s := log.NewAsyncSink(log.Stderr(), 8192)
+	defer s.Close()
+	benchmarkLogger(b, log.LogTrace, s, &log.LogfmtEncoder{})
+}
@@ -0,0 +1,263 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Defines the names of the encoders
+const (
+	EncoderConsole = "console"
+	EncoderText    = "text"
+	EncoderJSON    = "json"
+	EncoderLogfmt  = "logfmt"
+)
+
+// timeFormat is the format of the record time in the json and logfmt
+// encoders
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Encoder renders the records written to an output
+type Encoder interface {
+	// Encode appends the record terminated by a newline to the buffer
+	Encode(b []byte, r *Record) []byte
+}
+
+// NewEncoder returns the encoder with the name, the caller of the records is
+// included if caller is true
+func NewEncoder(name string, caller bool) (Encoder, error) {
+	switch strings.ToLower(name) {
+	case EncoderConsole:
+		return &ConsoleEncoder{Caller: caller, Color: true}, nil
+	case EncoderText:
+		return &ConsoleEncoder{Caller: caller}, nil
+	case EncoderJSON:
+		return &JSONEncoder{Caller: caller}, nil
+	case EncoderLogfmt:
+		return &LogfmtEncoder{Caller: caller}, nil
+	}
+	return nil, fmt.Errorf("unrecognized log encoder %q", name)
+}
+
+// ConsoleEncoder renders the records as human readable lines, colored with
+// ansi escape codes if Color is true
+type ConsoleEncoder struct {
+	Caller bool
+	Color  bool
+}
+
+func (e *ConsoleEncoder) needsCaller() bool {
+	return e.Caller
+}
+
+// Encode implements Encoder
+func (e *ConsoleEncoder) Encode(b []byte, r *Record) []byte {
+	if e.Color {
+		c := NewWriter()
+		c.Write(c.Green(r.Level.Head()))
+		c.Write(c.Green(" | "))
+		c.Write(c.Grey(c.Bold(r.Time.Format("2006-01-02T15:04:05"))))
+		c.Write(" ")
+		if e.Caller {
+			c.Write(c.LightGrey(caller(r)))
+			c.Write(" ")
+		}
+		if len(r.Name) > 0 {
+			c.Write(c.Blue(r.Name + ":"))
+			c.Write(" ")
+		}
+		c.Write(r.Msg)
+		c.Write(" ")
+		for _, field := range expandFields(r.Fields) {
+			c.Write(c.LightGrey("["))
+			if len(field.Key) > 0 {
+				c.Write(c.LightGrey(field.Key))
+				c.Write(c.LightGrey(": "))
+			}
+			c.Write(c.LightGrey(field.Value()))
+			c.Write(c.LightGrey("] "))
+		}
+		return append(b, c.String()...)
+	}
+
+	b = append(b, r.Level.Head()...)
+	b = append(b, " | "...)
+	b = r.Time.AppendFormat(b, "2006-01-02T15:04:05")
+	b = append(b, ' ')
+	if e.Caller {
+		b = append(b, caller(r)...)
+		b = append(b, ' ')
+	}
+	if len(r.Name) > 0 {
+		b = append(b, r.Name...)
+		b = append(b, ": "...)
+	}
+	b = append(b, r.Msg...)
+	b = append(b, ' ')
+	for _, field := range expandFields(r.Fields) {
+		b = append(b, '[')
+		if len(field.Key) > 0 {
+			b = append(b, field.Key...)
+			b = append(b, ": "...)
+		}
+		b = append(b, field.Value()...)
+		b = append(b, "] "...)
+	}
+	return append(b, '\n')
+}
+
+// JSONEncoder renders the records as json objects, the fields are members
+// of the object
+type JSONEncoder struct {
+	Caller bool
+}
+
+func (e *JSONEncoder) needsCaller() bool {
+	return e.Caller
+}
+
+// Encode implements Encoder
+func (e *JSONEncoder) Encode(b []byte, r *Record) []byte {
+	b = append(b, `{"time":"`...)
+	b = r.Time.AppendFormat(b, timeFormat)
+	b = append(b, `","level":"`...)
+	b = append(b, r.Level.String()...)
+	b = append(b, '"')
+	if len(r.Name) > 0 {
+		b = append(b, `,"logger":`...)
+		b = appendJSONString(b, r.Name)
+	}
+	b = append(b, `,"msg":`...)
+	b = appendJSONString(b, r.Msg)
+	if e.Caller {
+		b = append(b, `,"caller":`...)
+		b = appendJSONString(b, caller(r))
+	}
+	for _, field := range expandFields(r.Fields) {
+		b = append(b, ',')
+		b = appendJSONString(b, fieldKey(field))
+		b = append(b, ':')
+		switch field.Type {
+		case IntegerType, BoolType:
+			b = append(b, field.Value()...)
+		case FloatType:
+			b = strconv.AppendFloat(b, field.Float, 'g', -1, 64)
+		case AnyType:
+			b = append(b, field.json()...)
+		default:
+			b = appendJSONString(b, field.Value())
+		}
+	}
+	return append(b, "}\n"...)
+}
+
+// LogfmtEncoder renders the records as key=value pairs
+type LogfmtEncoder struct {
+	Caller bool
+}
+
+func (e *LogfmtEncoder) needsCaller() bool {
+	return e.Caller
+}
+
+// Encode implements Encoder
+func (e *LogfmtEncoder) Encode(b []byte, r *Record) []byte {
+	b = append(b, "time="...)
+	b = r.Time.AppendFormat(b, timeFormat)
+	b = append(b, " level="...)
+	b = append(b, r.Level.String()...)
+	if len(r.Name) > 0 {
+		b = append(b, " logger="...)
+		b = appendLogfmtValue(b, r.Name)
+	}
+	b = append(b, " msg="...)
+	b = appendLogfmtValue(b, r.Msg)
+	if e.Caller {
+		b = append(b, " caller="...)
+		b = appendLogfmtValue(b, caller(r))
+	}
+	for _, field := range expandFields(r.Fields) {
+		b = append(b, ' ')
+		b = append(b, fieldKey(field)...)
+		b = append(b, '=')
+		b = appendLogfmtValue(b, field.Value())
+	}
+	return append(b, '\n')
+}
+
+// fieldKey returns the key of the field, the tags have none
+func fieldKey(f Field) string {
+	if len(f.Key) == 0 {
+		return "tag"
+	}
+	return f.Key
+}
+
+func caller(r *Record) string {
+	return fmt.Sprintf("%v", r.Call)
+}
+
+func appendLogfmtValue(b []byte, s string) []byte {
+	if len(s) == 0 {
+		return append(b, `""`...)
+	}
+	for _, c := range s {
+		if c <= ' ' || c == '=' || c == '"' || c == utf8.RuneError {
+			return strconv.AppendQuote(b, s)
+		}
+	}
+	return append(b, s...)
+}
+
+const hex = "0123456789abcdef"
+
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c == '\n':
+				b = append(b, '\\', 'n')
+			case c == '\r':
+				b = append(b, '\\', 'r')
+			case c == '\t':
+				b = append(b, '\\', 't')
+			case c < 0x20:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				b = append(b, c)
+			}
+			i++
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && n == 1 {
+			b = append(b, "\ufffd"...)
+		} else {
+			b = append(b, s[i:i+n]...)
+		}
+		i += n
+	}
+	return append(b, '"')
+}
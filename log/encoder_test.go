@@ -0,0 +1,98 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-stack/stack"
+	"github.com/samuelngs/smartdns/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRecord() *log.Record {
+	return &log.Record{
+		Time:  time.Date(2019, time.September, 21, 0, 0, 0, 0, time.UTC),
+		Level: log.LogWarn,
+		Msg:   "could not \"dial\"",
+		Fields: []log.Field{
+			log.String("remote-addr", "10.0.0.1:443"),
+			log.Int("port", 443),
+			log.Float64("ratio", 0.5),
+			log.Bool("tls", true),
+			log.Tag("retry"),
+		},
+		Call: stack.Caller(0),
+	}
+}
+
+func TestTextEncoder(t *testing.T) {
+	e, err := log.NewEncoder(log.EncoderText, false)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"WARN  | 2019-09-21T00:00:00 could not \"dial\" [remote-addr: 10.0.0.1:443] [port: 443] [ratio: 0.500000] [tls: true] [retry] \n",
+		string(e.Encode(nil, testRecord())))
+}
+
+func TestJSONEncoder(t *testing.T) {
+	e, err := log.NewEncoder(log.EncoderJSON, true)
+	assert.NoError(t, err)
+	b := e.Encode(nil, testRecord())
+	assert.True(t, strings.HasSuffix(string(b), "}\n"))
+
+	var o map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &o))
+	assert.Equal(t, map[string]interface{}{
+		"time":        "2019-09-21T00:00:00.000Z",
+		"level":       "warn",
+		"msg":         "could not \"dial\"",
+		"caller":      o["caller"],
+		"remote-addr": "10.0.0.1:443",
+		"port":        float64(443),
+		"ratio":       0.5,
+		"tls":         true,
+		"tag":         "retry",
+	}, o)
+	assert.Contains(t, o["caller"], "encoder_test.go:")
+
+	r := testRecord()
+	r.Msg = "tab\tnul\x00invalid\xff"
+	assert.NoError(t, json.Unmarshal(e.Encode(nil, r), &o))
+	assert.Equal(t, "tab\tnul\x00invalid\ufffd", o["msg"])
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	e, err := log.NewEncoder(log.EncoderLogfmt, false)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`time=2019-09-21T00:00:00.000Z level=warn msg="could not \"dial\"" remote-addr=10.0.0.1:443 port=443 ratio=0.500000 tls=true tag=retry`+"\n",
+		string(e.Encode(nil, testRecord())))
+}
+
+func TestConsoleEncoder(t *testing.T) {
+	r := testRecord()
+	r.Fields = []log.Field{log.String("key", "val")}
+	e, err := log.NewEncoder(log.EncoderConsole, false)
+	assert.NoError(t, err)
+	assert.Equal(t, r.String(), string(e.Encode(nil, r)))
+
+	_, err = log.NewEncoder("xml", false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log
+
+import (
+	"os"
+	"sync"
+)
+
+// Syncer is implemented by the sinks that buffer or cache the entries
+type Syncer interface {
+	Sync() error
+}
+
+var (
+	exitMu    sync.Mutex
+	exitFunc  = os.Exit
+	exitHooks []*func()
+)
+
+// SetExitFunc sets the function Fatal exits the process with and returns the
+// previous one, the tests replace os.Exit with it
+func SetExitFunc(fn func(code int)) func(code int) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	prev := exitFunc
+	exitFunc = fn
+	return prev
+}
+
+// RegisterExitHook registers a function that Fatal runs before the process
+// exits, the hooks run in the order they were registered. The returned
+// function unregisters the hook
+func RegisterExitHook(fn func()) func() {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	hook := &fn
+	exitHooks = append(exitHooks, hook)
+	return func() {
+		exitMu.Lock()
+		defer exitMu.Unlock()
+		hooks := make([]*func(), 0, len(exitHooks))
+		for _, h := range exitHooks {
+			if h != hook {
+				hooks = append(hooks, h)
+			}
+		}
+		exitHooks = hooks
+	}
+}
+
+func runExitHooks() {
+	exitMu.Lock()
+	hooks := exitHooks
+	exitMu.Unlock()
+	for _, fn := range hooks {
+		(*fn)()
+	}
+}
+
+func exit(code int) {
+	exitMu.Lock()
+	fn := exitFunc
+	exitMu.Unlock()
+	fn(code)
+}
+
+// Flush writes the entries buffered by the outputs
+func Flush() error {
+	var err error
+	for _, o := range currentOutputs().outputs {
+		if s, ok := o.Sink.(Syncer); ok {
+			if serr := s.Sync(); serr != nil && err == nil {
+				err = serr
+			}
+		}
+	}
+	return err
+}
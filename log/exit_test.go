@@ -0,0 +1,75 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log_test
+
+import (
+	"testing"
+
+	"github.com/samuelngs/smartdns/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type syncSink struct {
+	bufferSink
+	synced bool
+}
+
+func (s *syncSink) Sync() error {
+	s.synced = true
+	return nil
+}
+
+func TestFatal(t *testing.T) {
+	defer log.SetFormat(log.EncoderConsole, false)
+
+	out := new(syncSink)
+	log.SetOutputs(log.NewOutput(out, log.LogTrace, &log.LogfmtEncoder{}))
+
+	var steps []string
+	unregister := log.RegisterExitHook(func() {
+		assert.True(t, out.synced)
+		steps = append(steps, "hook")
+	})
+	defer unregister()
+	prev := log.SetExitFunc(func(code int) {
+		steps = append(steps, "exit")
+		assert.Equal(t, 1, code)
+	})
+	defer log.SetExitFunc(prev)
+
+	log.NewLogger().Fatal("could not listen", log.String("address", ":53"))
+	assert.Equal(t, []string{"hook", "exit"}, steps)
+	assert.Contains(t, out.String(), `level=fatal msg="could not listen" address=:53`+"\n")
+
+	unregister()
+	steps = nil
+	log.NewLogger().Fatal("could not listen")
+	assert.Equal(t, []string{"exit"}, steps)
+}
+
+func TestPanic(t *testing.T) {
+	defer log.SetFormat(log.EncoderConsole, false)
+
+	out := new(syncSink)
+	log.SetOutputs(log.NewOutput(out, log.LogError, &log.LogfmtEncoder{}))
+
+	assert.PanicsWithValue(t, "invalid state", func() {
+		log.NewLogger().Panic("invalid state")
+	})
+	assert.True(t, out.synced)
+	assert.Contains(t, out.String(), `level=panic msg="invalid state"`+"\n")
+}
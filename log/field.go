@@ -16,7 +16,16 @@
 
 package log
 
-import "strconv"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // FieldType defines the type of field
 type FieldType uint8
@@ -29,6 +38,18 @@ const (
 	FloatType
 	StringType
 	BoolType
+	ErrorType
+	DurationType
+	TimeType
+	IPType
+	StringerType
+	AnyType
+)
+
+// minTime and maxTime are the times that can be stored as unix nanoseconds
+var (
+	minTime = time.Unix(0, -1<<63)
+	maxTime = time.Unix(0, 1<<63-1)
 )
 
 // Field encapsulates logging fields
@@ -40,6 +61,9 @@ type Field struct {
 	Float   float64   `json:"float,omitempty"`
 	String  string    `json:"string,omitempty"`
 	Bool    bool      `json:"bool,omitempty"`
+	// Interface holds the error, stringer or value of the field, it is
+	// rendered only when the record is written
+	Interface interface{} `json:"-"`
 }
 
 // Value returns field data in string format
@@ -59,6 +83,21 @@ func (f Field) Value() string {
 			return "true"
 		}
 		return "false"
+	case ErrorType:
+		if f.Interface == nil {
+			return "<nil>"
+		}
+		return f.Interface.(error).Error()
+	case DurationType:
+		return time.Duration(f.Integer).String()
+	case TimeType:
+		return f.time().Format(time.RFC3339Nano)
+	case IPType:
+		return net.IP(f.Binary).String()
+	case StringerType:
+		return stringerValue(f.Interface)
+	case AnyType:
+		return string(f.json())
 	default:
 		return "unknown"
 	}
@@ -143,3 +182,120 @@ func Float32(k string, f float32) Field {
 func Float64(k string, f float64) Field {
 	return Field{Key: k, Type: FloatType, Float: f}
 }
+
+// Error returns a field with the key "error" that contains the error
+func Error(err error) Field {
+	return NamedError("error", err)
+}
+
+// NamedError returns a field that contains the error, the types of the
+// errors it wraps are rendered in a field with the "_chain" suffix
+func NamedError(k string, err error) Field {
+	return Field{Key: k, Type: ErrorType, Interface: err}
+}
+
+// Duration returns a field that contains duration data
+func Duration(k string, d time.Duration) Field {
+	return Field{Key: k, Type: DurationType, Integer: int64(d)}
+}
+
+// Time returns a field that contains time data
+func Time(k string, t time.Time) Field {
+	if t.Before(minTime) || t.After(maxTime) {
+		return Field{Key: k, Type: TimeType, Interface: t}
+	}
+	return Field{Key: k, Type: TimeType, Integer: t.UnixNano(), Interface: t.Location()}
+}
+
+// IP returns a field that contains an ip address
+func IP(k string, ip net.IP) Field {
+	return Field{Key: k, Type: IPType, Binary: ip}
+}
+
+// Addr returns a field that contains a network address
+func Addr(k string, a net.Addr) Field {
+	return Stringer(k, a)
+}
+
+// Stringer returns a field that contains the string of the value, the
+// String method is only called when the record is written
+func Stringer(k string, s fmt.Stringer) Field {
+	return Field{Key: k, Type: StringerType, Interface: s}
+}
+
+// Any returns a field that contains the value encoded as json, the value is
+// only encoded when the record is written
+func Any(k string, v interface{}) Field {
+	return Field{Key: k, Type: AnyType, Interface: v}
+}
+
+func (f Field) time() time.Time {
+	switch v := f.Interface.(type) {
+	case time.Time:
+		return v
+	case *time.Location:
+		return time.Unix(0, f.Integer).In(v)
+	}
+	return time.Unix(0, f.Integer).UTC()
+}
+
+// json returns the value of an AnyType field encoded as json, or the error
+// as a json string if it cannot be encoded
+func (f Field) json() []byte {
+	b, err := json.Marshal(f.Interface)
+	if err != nil {
+		return appendJSONString(nil, "!error: "+err.Error())
+	}
+	return b
+}
+
+// chain returns the field with the types of the errors wrapped by the error
+// of the field
+func (f Field) chain() (Field, bool) {
+	err, _ := f.Interface.(error)
+	if f.Type != ErrorType || err == nil || errors.Unwrap(err) == nil {
+		return Field{}, false
+	}
+	var types []string
+	for ; err != nil; err = errors.Unwrap(err) {
+		types = append(types, fmt.Sprintf("%T", err))
+	}
+	return String(fieldKey(f)+"_chain", strings.Join(types, " > ")), true
+}
+
+// expandFields returns the fields with the chains of the wrapped errors
+// following their errors
+func expandFields(fields []Field) []Field {
+	for i, f := range fields {
+		if _, ok := f.chain(); !ok {
+			continue
+		}
+		expanded := append(make([]Field, 0, len(fields)+1), fields[:i]...)
+		for _, f := range fields[i:] {
+			expanded = append(expanded, f)
+			if c, ok := f.chain(); ok {
+				expanded = append(expanded, c)
+			}
+		}
+		return expanded
+	}
+	return fields
+}
+
+// stringerValue calls String, a nil pointer that panics is rendered as
+// <nil> like the fmt package does
+func stringerValue(v interface{}) (s string) {
+	if v == nil {
+		return "<nil>"
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+				s = "<nil>"
+				return
+			}
+			s = fmt.Sprintf("<PANIC=%v>", err)
+		}
+	}()
+	return v.(fmt.Stringer).String()
+}
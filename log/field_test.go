@@ -0,0 +1,127 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/smartdns/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type upstream struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+type hostname string
+
+func (h *hostname) String() string {
+	return string(*h)
+}
+
+func typedRecord() *log.Record {
+	err := fmt.Errorf("dial upstream: %w", fmt.Errorf("connect: %w", errors.New("refused")))
+	return &log.Record{
+		Time:  time.Date(2019, time.September, 21, 0, 0, 0, 0, time.UTC),
+		Level: log.LogWarn,
+		Msg:   "failed",
+		Fields: []log.Field{
+			log.Error(err),
+			log.Duration("elapsed", 1500*time.Millisecond),
+			log.Time("started", time.Date(2019, time.September, 20, 23, 59, 58, 500, time.UTC)),
+			log.IP("ip", net.ParseIP("10.0.0.1")),
+			log.Addr("remote-addr", &net.TCPAddr{IP: net.ParseIP("::1"), Port: 443}),
+			log.Stringer("hostname", (*hostname)(nil)),
+			log.Any("upstream", &upstream{Host: "netflix.com", Port: 443}),
+		},
+	}
+}
+
+func TestTypedFieldsLogfmt(t *testing.T) {
+	assert.Equal(t,
+		`time=2019-09-21T00:00:00.000Z level=warn msg=failed `+
+			`error="dial upstream: connect: refused" `+
+			`error_chain="*fmt.wrapError > *fmt.wrapError > *errors.errorString" `+
+			`elapsed=1.5s started=2019-09-20T23:59:58.0000005Z ip=10.0.0.1 `+
+			`remote-addr=[::1]:443 hostname=<nil> upstream="{\"host\":\"netflix.com\",\"port\":443}"`+"\n",
+		string((&log.LogfmtEncoder{}).Encode(nil, typedRecord())))
+}
+
+func TestTypedFieldsJSON(t *testing.T) {
+	var o map[string]interface{}
+	assert.NoError(t, json.Unmarshal((&log.JSONEncoder{}).Encode(nil, typedRecord()), &o))
+	assert.Equal(t, "dial upstream: connect: refused", o["error"])
+	assert.Equal(t, "*fmt.wrapError > *fmt.wrapError > *errors.errorString", o["error_chain"])
+	assert.Equal(t, "1.5s", o["elapsed"])
+	assert.Equal(t, "2019-09-20T23:59:58.0000005Z", o["started"])
+	assert.Equal(t, "10.0.0.1", o["ip"])
+	assert.Equal(t, "[::1]:443", o["remote-addr"])
+	assert.Equal(t, "<nil>", o["hostname"])
+	assert.Equal(t, map[string]interface{}{"host": "netflix.com", "port": float64(443)}, o["upstream"])
+}
+
+func TestTypedFieldsText(t *testing.T) {
+	r := typedRecord()
+	r.Fields = r.Fields[:2]
+	assert.Equal(t,
+		"WARN  | 2019-09-21T00:00:00 failed "+
+			"[error: dial upstream: connect: refused] "+
+			"[error_chain: *fmt.wrapError > *fmt.wrapError > *errors.errorString] "+
+			"[elapsed: 1.5s] \n",
+		string((&log.ConsoleEncoder{}).Encode(nil, r)))
+}
+
+func TestFieldValues(t *testing.T) {
+	assert.Equal(t, "<nil>", log.Error(nil).Value())
+	assert.Equal(t, "refused", log.Error(errors.New("refused")).Value())
+	assert.Equal(t, "<nil>", log.IP("ip", nil).Value())
+	assert.Equal(t, "<nil>", log.Stringer("s", nil).Value())
+	assert.Equal(t, `"!error: json: unsupported type: chan int"`, log.Any("c", make(chan int)).Value())
+	assert.Equal(t, "0001-01-01T00:00:00Z", log.Time("t", time.Time{}).Value())
+
+	local := time.Date(2019, time.September, 21, 8, 0, 0, 0, time.FixedZone("HKT", 8*3600))
+	assert.Equal(t, "2019-09-21T08:00:00+08:00", log.Time("t", local).Value())
+}
+
+func TestDisabledFieldsDoNotAllocate(t *testing.T) {
+	defer log.SetLevels(log.Levels())
+	log.SetLevel(log.LogInfo)
+
+	err := fmt.Errorf("dial upstream: %w", errors.New("refused"))
+	ip := net.ParseIP("10.0.0.1")
+	addr := &net.TCPAddr{IP: ip, Port: 443}
+	u := &upstream{Host: "netflix.com", Port: 443}
+	now := time.Now()
+
+	logger := log.NewLogger()
+	assert.False(t, logger.Enabled(log.LogDebug))
+	assert.Equal(t, float64(0), testing.AllocsPerRun(100, func() {
+		logger.Debug("dialing",
+			log.Error(err),
+			log.Duration("elapsed", time.Second),
+			log.Time("started", now),
+			log.IP("ip", ip),
+			log.Addr("remote-addr", addr),
+			log.Any("upstream", u))
+	}))
+}
@@ -0,0 +1,205 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileOptions are the rotation limits of a file sink
+type FileOptions struct {
+	// MaxSize is the size in bytes the file is rotated at, a non-positive
+	// size disables the rotation
+	MaxSize int64
+	// MaxBackups is the number of rotated files kept
+	MaxBackups int
+	// MaxAge is how long the rotated files are kept, they are kept until
+	// there are too many of them if it is zero
+	MaxAge time.Duration
+	// Compress compresses the rotated files with gzip
+	Compress bool
+}
+
+// fileSink writes to a file that is rotated when it grows over the maximum
+// size, the rotated files are numbered from the most recent one
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+	opts FileOptions
+	f    *os.File
+	size int64
+}
+
+// NewFileSink opens the file for appending, it is rotated when it would grow
+// over maxSize bytes and at most maxBackups rotated files are kept. A
+// non-positive size disables the rotation.
+func NewFileSink(path string, maxSize int64, maxBackups int) (Sink, error) {
+	return NewRotatingFileSink(path, FileOptions{MaxSize: maxSize, MaxBackups: maxBackups})
+}
+
+// NewRotatingFileSink opens the file for appending, it is rotated within the
+// limits of the options
+func NewRotatingFileSink(path string, opts FileOptions) (Sink, error) {
+	s := &fileSink{path: path, opts: opts}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, info.Size()
+	return nil
+}
+
+func (s *fileSink) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return 0, os.ErrClosed
+	}
+	if s.opts.MaxSize > 0 && s.size > 0 && s.size+int64(len(b)) > s.opts.MaxSize {
+		if err := s.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.f.Write(b)
+	s.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the numbered backups and moves the current file to the
+// first one
+func (s *fileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	s.f = nil
+	if s.opts.MaxBackups <= 0 {
+		os.Remove(s.path)
+		return s.open()
+	}
+
+	os.Remove(s.backup(s.opts.MaxBackups))
+	for i := s.opts.MaxBackups - 1; i > 0; i-- {
+		os.Rename(s.backup(i), s.backup(i+1))
+	}
+	if !s.opts.Compress {
+		if err := os.Rename(s.path, s.backup(1)); err != nil {
+			return err
+		}
+	} else if err := compress(s.path, s.backup(1)); err != nil {
+		return err
+	}
+	if s.opts.MaxAge > 0 {
+		s.removeExpired()
+	}
+	return s.open()
+}
+
+// removeExpired removes the rotated files older than the maximum age, the
+// files are numbered from the most recent one so the ones after the first
+// expired file are expired too
+func (s *fileSink) removeExpired() {
+	for i := 1; i <= s.opts.MaxBackups; i++ {
+		info, err := os.Stat(s.backup(i))
+		if err != nil || time.Since(info.ModTime()) <= s.opts.MaxAge {
+			continue
+		}
+		for ; i <= s.opts.MaxBackups; i++ {
+			os.Remove(s.backup(i))
+		}
+	}
+}
+
+func (s *fileSink) backup(n int) string {
+	if s.opts.Compress {
+		return fmt.Sprintf("%s.%d.gz", s.path, n)
+	}
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
+
+// compress writes the gzip compressed file to dst and removes the file, the
+// compressed file keeps the modification time of the file
+func compress(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+	return os.Remove(src)
+}
+
+// Sync commits the file to the disk
+func (s *fileSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Sync()
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
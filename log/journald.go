@@ -0,0 +1,139 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// journalSocket is the socket of the native protocol of systemd-journald
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalSink sends the entries to systemd-journald with its native
+// protocol, every entry is a datagram of fields
+type journalSink struct {
+	mu         sync.Mutex
+	conn       net.Conn
+	identifier string
+}
+
+// NewJournalSink connects to the journal socket, the default socket is used
+// if the path is empty. The records are sent with their fields as journal
+// fields, the entries written as text are sent as messages.
+func NewJournalSink(path string) (Sink, error) {
+	if len(path) == 0 {
+		path = journalSocket
+	}
+	c, err := net.Dial("unixgram", path)
+	if err != nil {
+		return nil, err
+	}
+	return &journalSink{conn: c, identifier: filepath.Base(os.Args[0])}, nil
+}
+
+func (s *journalSink) Write(b []byte) (int, error) {
+	var buf bytes.Buffer
+	appendJournalField(&buf, "PRIORITY", "6")
+	appendJournalField(&buf, "SYSLOG_IDENTIFIER", s.identifier)
+	appendJournalField(&buf, "MESSAGE", string(bytes.TrimRight(b, "\n")))
+	if err := s.send(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// WriteRecord implements RecordWriter
+func (s *journalSink) WriteRecord(r *Record, _ []byte) error {
+	var buf bytes.Buffer
+	appendJournalField(&buf, "PRIORITY", strconv.Itoa(r.Level.severity()))
+	appendJournalField(&buf, "SYSLOG_IDENTIFIER", s.identifier)
+	appendJournalField(&buf, "MESSAGE", r.Msg)
+	if f := r.Call.Frame(); len(f.File) > 0 {
+		appendJournalField(&buf, "CODE_FILE", f.File)
+		appendJournalField(&buf, "CODE_LINE", strconv.Itoa(f.Line))
+		appendJournalField(&buf, "CODE_FUNC", f.Function)
+	}
+	for _, field := range expandFields(r.Fields) {
+		appendJournalField(&buf, journalKey(fieldKey(field)), field.Value())
+	}
+	return s.send(buf.Bytes())
+}
+
+// needsCaller reports that the records are sent with their source location
+func (s *journalSink) needsCaller() bool {
+	return true
+}
+
+func (s *journalSink) send(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return os.ErrClosed
+	}
+	_, err := s.conn.Write(b)
+	return err
+}
+
+func (s *journalSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// appendJournalField appends the field, the values with newlines are sent in
+// the binary form prefixed by their length
+func appendJournalField(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	if !strings.ContainsRune(value, '\n') {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalKey converts the key to a journal field name, which has only upper
+// case letters, digits and underscores and does not start with one
+func journalKey(k string) string {
+	b := []byte(strings.ToUpper(k))
+	for i, c := range b {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			b[i] = '_'
+		}
+	}
+	k = strings.TrimLeft(string(b), "_")
+	if len(k) == 0 {
+		return "FIELD"
+	}
+	return k
+}
@@ -19,11 +19,57 @@ package log
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-// lvl sets current logging level
-var lvl = LogInfo
+// levels holds the current *levelConfig, it is replaced rather than modified
+// so that the loggers read it without locking
+var levels atomic.Value
+
+// levelsMu serializes the changes of the levels
+var levelsMu sync.Mutex
+
+// levelConfig is the default level and the levels of the named loggers
+type levelConfig struct {
+	def   Level
+	names map[string]Level
+}
+
+// level returns the level of the logger with the name, a logger without a
+// level of its own has the level of its parent
+func (c *levelConfig) level(name string) Level {
+	for len(c.names) > 0 && len(name) > 0 {
+		if l, ok := c.names[name]; ok {
+			return l
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return c.def
+}
+
+func currentLevels() *levelConfig {
+	return levels.Load().(*levelConfig)
+}
+
+// updateLevels applies the change to a copy of the levels and swaps it in
+func updateLevels(fn func(c *levelConfig)) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+	old := currentLevels()
+	c := &levelConfig{def: old.def, names: make(map[string]Level, len(old.names))}
+	for name, l := range old.names {
+		c.names[name] = l
+	}
+	fn(c)
+	levels.Store(c)
+}
 
 // Level defines the importance and urgency of the log message
 type Level int
@@ -36,10 +82,14 @@ const (
 	LogInfo
 	LogDebug
 	LogTrace
+	// LogPanic is appended to keep the values of the other levels, it ranks
+	// between LogFatal and LogError
+	LogPanic
 )
 
 var logLevelRefs = map[Level]string{
 	LogFatal: "fatal",
+	LogPanic: "panic",
 	LogError: "error",
 	LogWarn:  "warn",
 	LogInfo:  "info",
@@ -49,6 +99,7 @@ var logLevelRefs = map[Level]string{
 
 var logLevelIds = map[string]Level{
 	"fatal": LogFatal,
+	"panic": LogPanic,
 	"error": LogError,
 	"warn":  LogWarn,
 	"info":  LogInfo,
@@ -56,6 +107,20 @@ var logLevelIds = map[string]Level{
 	"trace": LogTrace,
 }
 
+// rank orders the levels from the most to the least important
+func (l Level) rank() int {
+	if l == LogPanic {
+		return 1
+	}
+	return int(l) * 2
+}
+
+// covers returns true if the records of the level are written at the
+// threshold
+func (l Level) covers(threshold Level) bool {
+	return l.rank() <= threshold.rank()
+}
+
 // Head pads log level reference to 5 characters, this would
 // left-justifies the strings and add spaces to fill the empty
 // columns on the right.
@@ -73,27 +138,105 @@ func (l Level) String() string {
 	panic("unrecognized log level")
 }
 
-// LevelFromString returns the log level enum from a string
+// severity returns the syslog severity of the level
+func (l Level) severity() int {
+	switch l {
+	case LogFatal, LogPanic:
+		return 2
+	case LogError:
+		return 3
+	case LogWarn:
+		return 4
+	case LogInfo:
+		return 6
+	}
+	return 7
+}
+
+// LevelFromString returns the log level enum from a string, or LogInfo if
+// the string is not a level
+//
+// Deprecated: use ParseLevel to detect the invalid levels
 func LevelFromString(s string) Level {
-	if l, ok := logLevelIds[strings.ToLower(s)]; ok {
+	if l, err := ParseLevel(s); err == nil {
 		return l
 	}
-	panic("unrecognized log level")
+	return LogInfo
+}
+
+// ParseLevel returns the level of the name, * is the most verbose one
+func ParseLevel(s string) (Level, error) {
+	if s == "*" {
+		return LogTrace, nil
+	}
+	if l, ok := logLevelIds[strings.ToLower(s)]; ok {
+		return l, nil
+	}
+	return LogInfo, fmt.Errorf("unrecognized log level %q", s)
 }
 
 // SetLevel sets the logging verbose level
 func SetLevel(l Level) {
-	lvl = l
+	updateLevels(func(c *levelConfig) { c.def = l })
+}
+
+// SetNamedLevel sets the level of the logger with the name and its children
+func SetNamedLevel(name string, l Level) {
+	updateLevels(func(c *levelConfig) { c.names[name] = l })
+}
+
+// SetLevels sets the levels from a comma separated list of levels of the
+// named loggers such as "info,sniproxy=trace,dnsproxy=debug", the entry
+// without a name is the level of the other loggers
+func SetLevels(spec string) error {
+	def, names := LogInfo, make(map[string]Level)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		name, level := "", entry
+		if i := strings.IndexByte(entry, '='); i >= 0 {
+			name, level = strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		}
+		l, err := ParseLevel(level)
+		if err != nil {
+			return err
+		}
+		if len(name) == 0 {
+			def = l
+		} else {
+			names[name] = l
+		}
+	}
+	levelsMu.Lock()
+	levels.Store(&levelConfig{def: def, names: names})
+	levelsMu.Unlock()
+	return nil
+}
+
+// Levels returns the levels in the format of SetLevels
+func Levels() string {
+	c := currentLevels()
+	names := make([]string, 0, len(c.names))
+	for name := range c.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := []string{c.def.String()}
+	for _, name := range names {
+		entries = append(entries, name+"="+c.names[name].String())
+	}
+	return strings.Join(entries, ",")
 }
 
 func init() {
-	l, ok := os.LookupEnv("LOG")
-	switch {
-	case l == "*":
-		lvl = LogTrace
-	case ok:
-		lvl = LevelFromString(l)
-	default:
-		lvl = LogInfo
+	levels.Store(&levelConfig{def: LogInfo})
+	if l, ok := os.LookupEnv("LOG"); ok {
+		if err := SetLevels(l); err != nil {
+			// the outputs are not set up yet, a typo should not prevent
+			// smartdns from starting
+			fmt.Fprintf(os.Stderr, "ignored LOG environment variable: %v\n", err)
+		}
 	}
 }
@@ -25,6 +25,7 @@ import (
 
 func TestLevelHead(t *testing.T) {
 	assert.Equal(t, "FATAL", log.LogFatal.Head())
+	assert.Equal(t, "PANIC", log.LogPanic.Head())
 	assert.Equal(t, "ERROR", log.LogError.Head())
 	assert.Equal(t, "WARN ", log.LogWarn.Head())
 	assert.Equal(t, "INFO ", log.LogInfo.Head())
@@ -37,6 +38,7 @@ func TestLevelHead(t *testing.T) {
 
 func TestLevelString(t *testing.T) {
 	assert.Equal(t, "fatal", log.LogFatal.String())
+	assert.Equal(t, "panic", log.LogPanic.String())
 	assert.Equal(t, "error", log.LogError.String())
 	assert.Equal(t, "warn", log.LogWarn.String())
 	assert.Equal(t, "info", log.LogInfo.String())
@@ -46,3 +48,26 @@ func TestLevelString(t *testing.T) {
 		_ = log.Level(9999).String()
 	})
 }
+
+func TestParseLevel(t *testing.T) {
+	for l := log.LogFatal; l <= log.LogPanic; l++ {
+		parsed, err := log.ParseLevel(l.String())
+		assert.NoError(t, err)
+		assert.Equal(t, l, parsed)
+	}
+	l, err := log.ParseLevel("*")
+	assert.NoError(t, err)
+	assert.Equal(t, log.LogTrace, l)
+	_, err = log.ParseLevel("verbose")
+	assert.Error(t, err)
+
+	assert.Equal(t, log.LogDebug, log.LevelFromString("debug"))
+	assert.Equal(t, log.LogInfo, log.LevelFromString("verbose"))
+}
+
+func TestLevelValues(t *testing.T) {
+	// the values are part of the encoded records and must not change
+	for i, l := range []log.Level{log.LogFatal, log.LogError, log.LogWarn, log.LogInfo, log.LogDebug, log.LogTrace, log.LogPanic} {
+		assert.Equal(t, log.Level(i), l)
+	}
+}
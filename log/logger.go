@@ -18,6 +18,9 @@ package log
 
 import (
 	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-stack/stack"
@@ -35,34 +38,130 @@ type Logger interface {
 	Info(string, ...Field)
 	Warn(string, ...Field)
 	Error(string, ...Field)
+	// Panic writes the record and panics with the message
+	Panic(string, ...Field)
+	// Fatal writes the record, flushes the outputs, runs the exit hooks
+	// and exits the process with status 1
 	Fatal(string, ...Field)
+	// With returns a child logger that adds the fields to the records
+	With(...Field) Logger
+	// Named returns a child logger with the name appended to the name of
+	// the logger, the level of the child is the level set for its name
+	Named(string) Logger
+	// Enabled reports whether the records of the level are written, the
+	// calls through the interface allocate their fields so the hot paths
+	// check it first
+	Enabled(Level) bool
 }
 
 type logger struct {
-	id string
+	id     string
+	fields []Field
 }
 
-func (l *logger) print(r *Record) {
-	if r.Level > lvl {
-		return
+// outputSet holds the outputs with the most verbose level they write and
+// whether any of them uses the caller of the records
+type outputSet struct {
+	outputs []*Output
+	level   Level
+	caller  bool
+}
+
+// outputs holds the *outputSet the records are written to
+var outputs atomic.Value
+
+func currentOutputs() *outputSet {
+	return outputs.Load().(*outputSet)
+}
+
+// SetOutputs sets the outputs the records are written to
+func SetOutputs(o ...*Output) {
+	set := &outputSet{outputs: o}
+	for _, output := range o {
+		if !output.Level.covers(set.level) {
+			set.level = output.Level
+		}
+		set.caller = set.caller || output.needsCaller()
+	}
+	outputs.Store(set)
+}
+
+// SetEncoder writes the records to stdout with the encoder
+func SetEncoder(e Encoder) {
+	SetOutputs(NewOutput(Stdout(), LogTrace, e))
+}
+
+// SetFormat writes the records to stdout with the encoder of the name, the
+// console encoder is not colored if stdout is not a terminal
+func SetFormat(name string, caller bool) error {
+	if len(name) == 0 {
+		name = EncoderConsole
+	}
+	e, err := NewEncoder(name, caller)
+	if err != nil {
+		return err
 	}
-	os.Stdout.WriteString(r.String())
+	SetEncoder(e)
+	return nil
+}
+
+// recordPool holds the records, they are only used while they are written
+var recordPool = sync.Pool{
+	New: func() interface{} {
+		return new(Record)
+	},
 }
 
 func (l *logger) log(lv Level, msg string, fields ...Field) {
-	l.print(&Record{
-		Time:   time.Now().UTC(),
-		Level:  lv,
-		Msg:    msg,
-		Fields: fields,
-		Call:   stack.Caller(skipLevel),
-	})
+	set := currentOutputs()
+	if len(set.outputs) == 0 || !lv.covers(set.level) || !lv.covers(currentLevels().level(l.id)) {
+		return
+	}
+	// the fields are copied so that the arguments do not escape and the
+	// disabled levels do not allocate
+	r := recordPool.Get().(*Record)
+	r.Time = time.Now().UTC()
+	r.Name = l.id
+	r.Level = lv
+	r.Msg = msg
+	r.Fields = append(append(r.Fields[:0], l.fields...), fields...)
+	r.Call = stack.Call{}
+	if set.caller {
+		r.Call = stack.Caller(skipLevel)
+	}
+	for _, o := range set.outputs {
+		o.write(r)
+	}
+	// the pooled record must not keep the values of the fields alive
+	for i := range r.Fields {
+		r.Fields[i] = Field{}
+	}
+	r.Fields = r.Fields[:0]
+	recordPool.Put(r)
+}
+
+func (l *logger) Enabled(lv Level) bool {
+	set := currentOutputs()
+	return len(set.outputs) > 0 && lv.covers(set.level) && lv.covers(currentLevels().level(l.id))
 }
 
 func (l *logger) ID() string {
 	return l.id
 }
 
+func (l *logger) With(fields ...Field) Logger {
+	f := make([]Field, 0, len(l.fields)+len(fields))
+	f = append(append(f, l.fields...), fields...)
+	return &logger{id: l.id, fields: f[:len(f):len(f)]}
+}
+
+func (l *logger) Named(name string) Logger {
+	if len(l.id) > 0 {
+		name = l.id + "." + name
+	}
+	return &logger{id: name, fields: l.fields}
+}
+
 func (l *logger) NL() {
 	os.Stdout.WriteString("\n")
 }
@@ -87,8 +186,24 @@ func (l *logger) Error(msg string, fields ...Field) {
 	l.log(LogError, msg, fields...)
 }
 
+func (l *logger) Panic(msg string, fields ...Field) {
+	l.log(LogPanic, msg, fields...)
+	Flush()
+	panic(msg)
+}
+
 func (l *logger) Fatal(msg string, fields ...Field) {
 	l.log(LogFatal, msg, fields...)
+	Flush()
+	runExitHooks()
+	exit(1)
+}
+
+func init() {
+	caller, _ := strconv.ParseBool(os.Getenv("LOG_CALLER"))
+	if err := SetFormat(os.Getenv("LOG_FORMAT"), caller); err != nil {
+		SetFormat(EncoderConsole, caller)
+	}
 }
 
 // NewLogger initializes and returns a new logger
@@ -0,0 +1,150 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/samuelngs/smartdns/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChildLoggers(t *testing.T) {
+	defer log.SetFormat(log.EncoderConsole, false)
+	defer log.SetLevels(log.Levels())
+
+	out := new(bufferSink)
+	log.SetOutputs(log.NewOutput(out, log.LogTrace, &log.LogfmtEncoder{}))
+	assert.NoError(t, log.SetLevels("warn,sniproxy=debug,sniproxy.dial=error"))
+	assert.Equal(t, "warn,sniproxy=debug,sniproxy.dial=error", log.Levels())
+
+	root := log.NewLogger()
+	proxy := root.Named("sniproxy").With(log.String("remote-addr", "10.0.0.1:5000"))
+	dial := proxy.Named("dial")
+	assert.Equal(t, "sniproxy", proxy.ID())
+	assert.Equal(t, "sniproxy.dial", dial.ID())
+
+	root.Info("root info")
+	proxy.Debug("proxy debug", log.Int("port", 443))
+	proxy.Trace("proxy trace")
+	dial.Warn("dial warn")
+	dial.Error("dial error")
+	proxy.Named("http").Debug("http debug")
+
+	assert.Equal(t,
+		"level=debug logger=sniproxy msg=\"proxy debug\" remote-addr=10.0.0.1:5000 port=443\n"+
+			"level=error logger=sniproxy.dial msg=\"dial error\" remote-addr=10.0.0.1:5000\n"+
+			"level=debug logger=sniproxy.http msg=\"http debug\" remote-addr=10.0.0.1:5000\n",
+		stripTime(out.String()))
+
+	// the fields of the children do not leak into each other
+	a := proxy.With(log.String("hostname", "a"))
+	b := proxy.With(log.String("hostname", "b"))
+	out.Reset()
+	a.Warn("a")
+	b.Warn("b")
+	assert.Contains(t, out.String(), "msg=a remote-addr=10.0.0.1:5000 hostname=a\n")
+	assert.Contains(t, out.String(), "msg=b remote-addr=10.0.0.1:5000 hostname=b\n")
+
+	assert.Error(t, log.SetLevels("info,sniproxy=loud"))
+	assert.Equal(t, "warn,sniproxy=debug,sniproxy.dial=error", log.Levels())
+}
+
+func TestConcurrentLevels(t *testing.T) {
+	defer log.SetFormat(log.EncoderConsole, false)
+	defer log.SetLevels(log.Levels())
+	log.SetOutputs(log.NewOutput(new(bufferSink), log.LogFatal, &log.LogfmtEncoder{}))
+
+	var wg sync.WaitGroup
+	logger := log.NewLogger().Named("dnsproxy")
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Debug("query")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				log.SetLevel(log.LogDebug)
+				log.SetNamedLevel("dnsproxy", log.LogTrace)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, "debug,dnsproxy=trace", log.Levels())
+}
+
+// stripTime removes the time of the logfmt lines
+func stripTime(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "time=") {
+			lines[i] = line[strings.IndexByte(line, ' ')+1:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// recordSink keeps the source files of the records written to it
+type recordSink struct {
+	bufferSink
+	files []string
+}
+
+func (s *recordSink) WriteRecord(r *log.Record, b []byte) error {
+	s.files = append(s.files, r.Call.Frame().File)
+	return nil
+}
+
+func TestCallerCapture(t *testing.T) {
+	defer log.SetFormat(log.EncoderConsole, false)
+
+	out := new(recordSink)
+	log.SetOutputs(log.NewOutput(out, log.LogTrace, &log.LogfmtEncoder{}))
+	logger := log.NewLogger()
+	logger.Warn("without caller")
+
+	log.SetOutputs(
+		log.NewOutput(out, log.LogTrace, &log.LogfmtEncoder{}),
+		log.NewOutput(new(bufferSink), log.LogTrace, &log.JSONEncoder{Caller: true}))
+	logger.Warn("with caller")
+
+	if assert.Len(t, out.files, 2) {
+		assert.Empty(t, out.files[0])
+		assert.True(t, strings.HasSuffix(out.files[1], "logger_test.go"), out.files[1])
+	}
+}
+
+func TestOutputLevels(t *testing.T) {
+	defer log.SetFormat(log.EncoderConsole, false)
+	defer log.SetLevels(log.Levels())
+	log.SetLevel(log.LogTrace)
+
+	log.SetOutputs(log.NewOutput(new(bufferSink), log.LogWarn, &log.LogfmtEncoder{}))
+	logger := log.NewLogger()
+	assert.True(t, logger.Enabled(log.LogWarn))
+	assert.False(t, logger.Enabled(log.LogInfo))
+
+	log.SetOutputs()
+	assert.False(t, logger.Enabled(log.LogError))
+	logger.Error("discarded")
+}
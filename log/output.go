@@ -0,0 +1,104 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log
+
+import "sync"
+
+// RecordWriter is implemented by the sinks that keep the level or the fields
+// of the records rather than only their encoded form
+type RecordWriter interface {
+	WriteRecord(r *Record, b []byte) error
+}
+
+// Output writes the records of its level or more important ones to a sink
+type Output struct {
+	Sink    Sink
+	Level   Level
+	Encoder Encoder
+}
+
+// NewOutput returns an output to the sink, the console encoder is not
+// colored if the sink is not a terminal
+func NewOutput(sink Sink, level Level, e Encoder) *Output {
+	if c, ok := e.(*ConsoleEncoder); ok && c.Color && !sinkIsTerminal(sink) {
+		e = &ConsoleEncoder{Caller: c.Caller}
+	}
+	return &Output{Sink: sink, Level: level, Encoder: e}
+}
+
+func (o *Output) write(r *Record) error {
+	if !r.Level.covers(o.Level) {
+		return nil
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = o.Encoder.Encode(*buf, r)
+	if w, ok := o.Sink.(RecordWriter); ok {
+		return w.WriteRecord(r, *buf)
+	}
+	_, err := o.Sink.Write(*buf)
+	return err
+}
+
+// callerNeeder is implemented by the encoders and sinks that know whether
+// they use the caller of the records
+type callerNeeder interface {
+	needsCaller() bool
+}
+
+// needsCaller reports whether the caller of the records has to be captured
+// for the output, the encoders that do not tell are assumed to use it
+func (o *Output) needsCaller() bool {
+	if s, ok := o.Sink.(callerNeeder); ok && s.needsCaller() {
+		return true
+	}
+	e, ok := o.Encoder.(callerNeeder)
+	return !ok || e.needsCaller()
+}
+
+func sinkIsTerminal(s Sink) bool {
+	switch o := s.(type) {
+	case stdSink:
+		return isTerminal(o.File)
+	case *AsyncSink:
+		return sinkIsTerminal(o.sink)
+	}
+	return false
+}
+
+// maxPooledBuffer is the capacity above which the buffers are not reused so
+// that a large record does not stay in memory
+const maxPooledBuffer = 16 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBuffer {
+		return
+	}
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
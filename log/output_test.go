@@ -0,0 +1,57 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/samuelngs/smartdns/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (s *bufferSink) Close() error {
+	return nil
+}
+
+func TestOutputs(t *testing.T) {
+	defer log.SetFormat(log.EncoderConsole, false)
+
+	all, warn := new(bufferSink), new(bufferSink)
+	log.SetOutputs(
+		log.NewOutput(all, log.LogTrace, &log.LogfmtEncoder{}),
+		log.NewOutput(warn, log.LogWarn, &log.JSONEncoder{}))
+	log.SetLevel(log.LogTrace)
+	defer log.SetLevel(log.LogInfo)
+
+	logger := log.NewLogger()
+	logger.Debug("resolving", log.String("name", "netflix.com"))
+	logger.Warn("could not resolve", log.String("name", "netflix.com"))
+
+	assert.Contains(t, all.String(), "level=debug msg=resolving name=netflix.com\n")
+	assert.Contains(t, all.String(), `level=warn msg="could not resolve" name=netflix.com`+"\n")
+	assert.NotContains(t, warn.String(), "resolving")
+	assert.Contains(t, warn.String(), `"level":"warn","msg":"could not resolve","name":"netflix.com"}`+"\n")
+
+	// the console encoder is not colored when the sink is not a terminal
+	o := log.NewOutput(all, log.LogTrace, &log.ConsoleEncoder{Color: true})
+	assert.Equal(t, &log.ConsoleEncoder{}, o.Encoder)
+}
@@ -28,27 +28,13 @@ const skipLevel = 2
 type Record struct {
 	Time   time.Time  `json:"time"`
 	Level  Level      `json:"level"`
+	Name   string     `json:"logger,omitempty"`
 	Msg    string     `json:"message"`
 	Fields []Field    `json:"fields"`
 	Call   stack.Call `json:"call"`
 }
 
+// String renders the record as a colored line
 func (r *Record) String() string {
-	c := NewWriter()
-	c.Write(c.Green(r.Level.Head()))
-	c.Write(c.Green(" | "))
-	c.Write(c.Grey(c.Bold(r.Time.Format("2006-01-02T15:04:05"))))
-	c.Write(" ")
-	c.Write(r.Msg)
-	c.Write(" ")
-	for _, field := range r.Fields {
-		c.Write(c.LightGrey("["))
-		if len(field.Key) > 0 {
-			c.Write(c.LightGrey(field.Key))
-			c.Write(c.LightGrey(": "))
-		}
-		c.Write(c.LightGrey(field.Value()))
-		c.Write(c.LightGrey("] "))
-	}
-	return c.String()
+	return string((&ConsoleEncoder{Color: true}).Encode(nil, r))
 }
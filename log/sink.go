@@ -0,0 +1,52 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log
+
+import (
+	"io"
+	"os"
+)
+
+// Sink is an output of log entries, every write holds complete entries
+type Sink interface {
+	io.Writer
+	Close() error
+}
+
+type stdSink struct {
+	*os.File
+}
+
+// Close leaves the standard stream open
+func (s stdSink) Close() error {
+	return nil
+}
+
+// Sync does nothing, the writes to the standard streams are not buffered
+func (s stdSink) Sync() error {
+	return nil
+}
+
+// Stdout returns the sink that writes to the standard output
+func Stdout() Sink {
+	return stdSink{os.Stdout}
+}
+
+// Stderr returns the sink that writes to the standard error
+func Stderr() Sink {
+	return stdSink{os.Stderr}
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-stack/stack"
+	"github.com/samuelngs/smartdns/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "queries.log")
+
+	s, err := log.NewFileSink(path, 10, 2)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := s.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.Close())
+
+	read := func(name string) string {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, "sub", name))
+		return string(b)
+	}
+	assert.Equal(t, "fourth\n", read("queries.log"))
+	assert.Equal(t, "third\n", read("queries.log.1"))
+	assert.Equal(t, "second\n", read("queries.log.2"))
+	assert.Equal(t, "", read("queries.log.3"))
+
+	// the file is appended to when it is opened again
+	s, err = log.NewFileSink(path, 0, 0)
+	if assert.NoError(t, err) {
+		s.Write([]byte("fifth\n"))
+		s.Close()
+	}
+	assert.Equal(t, "fourth\nfifth\n", read("queries.log"))
+}
+
+func TestSyslogSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.sock")
+
+	c, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skip("unixgram sockets are not supported")
+	}
+	defer c.Close()
+
+	s, err := log.NewSyslogSink("unixgram", path, "smartdns")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+	_, err = s.Write([]byte("hello\n"))
+	assert.NoError(t, err)
+
+	b := make([]byte, 512)
+	n, _, err := c.ReadFrom(b)
+	assert.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^<30>\w{3} [ \d]\d \d\d:\d\d:\d\d smartdns\[\d+\]: hello$`), string(b[:n]))
+}
+
+func TestRotatingFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "smartdns.log")
+
+	s, err := log.NewRotatingFileSink(path, log.FileOptions{MaxSize: 10, MaxBackups: 3, MaxAge: time.Hour, Compress: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		_, err := s.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+
+	read := func(name string) string {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return ""
+		}
+		b, _ := ioutil.ReadAll(zr)
+		return string(b)
+	}
+	assert.Equal(t, "second\n", read("smartdns.log.1.gz"))
+	assert.Equal(t, "first\n", read("smartdns.log.2.gz"))
+
+	// the rotated files older than the maximum age are removed
+	old := time.Now().Add(-time.Hour * 2)
+	os.Chtimes(filepath.Join(dir, "smartdns.log.2.gz"), old, old)
+	s.Write([]byte("fourth\n"))
+	assert.Equal(t, "third\n", read("smartdns.log.1.gz"))
+	assert.Equal(t, "second\n", read("smartdns.log.2.gz"))
+	_, err = os.Stat(filepath.Join(dir, "smartdns.log.3.gz"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestJournalSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.sock")
+
+	c, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skip("unixgram sockets are not supported")
+	}
+	defer c.Close()
+
+	s, err := log.NewJournalSink(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+	err = s.(log.RecordWriter).WriteRecord(&log.Record{
+		Level:  log.LogWarn,
+		Msg:    "could not dial",
+		Fields: []log.Field{log.String("remote-addr", "10.0.0.1"), log.String("_error", "line 1\nline 2")},
+		Call:   stack.Caller(0),
+	}, nil)
+	assert.NoError(t, err)
+
+	b := make([]byte, 1024)
+	n, _, err := c.ReadFrom(b)
+	assert.NoError(t, err)
+	b = b[:n]
+	assert.Contains(t, string(b), "PRIORITY=4\nSYSLOG_IDENTIFIER=")
+	assert.Contains(t, string(b), "MESSAGE=could not dial\n")
+	assert.Contains(t, string(b), "CODE_FILE=")
+	assert.Contains(t, string(b), "REMOTE_ADDR=10.0.0.1\n")
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len("line 1\nline 2")))
+	assert.True(t, bytes.Contains(b, append(append([]byte("ERROR\n"), size[:]...), "line 1\nline 2\n"...)))
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// syslogDaemon is the facility of the messages
+const syslogDaemon = 3 << 3
+
+// syslogSockets are the usual paths of the local syslog daemon
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogSink sends the entries to a syslog daemon in the BSD syslog format
+type syslogSink struct {
+	mu       sync.Mutex
+	network  string
+	addr     string
+	tag      string
+	severity int
+	conn     net.Conn
+}
+
+// NewSyslogSink connects to the syslog daemon, the network is one of unixgram,
+// unix, udp or tcp, and an empty address connects to the local daemon. The
+// entries written as text are sent with the informational severity and the
+// records with the severity of their level.
+func NewSyslogSink(network, addr, tag string) (Sink, error) {
+	if len(tag) == 0 {
+		tag = filepath.Base(os.Args[0])
+	}
+	s := &syslogSink{network: network, addr: addr, tag: tag, severity: 6}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *syslogSink) connect() error {
+	if len(s.addr) > 0 {
+		c, err := net.Dial(s.network, s.addr)
+		if err != nil {
+			return err
+		}
+		s.conn = c
+		return nil
+	}
+	for _, path := range syslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			if c, err := net.Dial(network, path); err == nil {
+				s.conn, s.network = c, network
+				return nil
+			}
+		}
+	}
+	return errors.New("could not connect to the local syslog daemon")
+}
+
+func (s *syslogSink) Write(b []byte) (int, error) {
+	if err := s.send(s.severity, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// WriteRecord implements RecordWriter
+func (s *syslogSink) WriteRecord(r *Record, b []byte) error {
+	return s.send(r.Level.severity(), b)
+}
+
+func (s *syslogSink) send(severity int, b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg := s.format(severity, bytes.TrimRight(b, "\n"))
+	if s.conn != nil {
+		if _, err := s.conn.Write(msg); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	// the daemon may have been restarted, reconnect once
+	if err := s.connect(); err != nil {
+		return err
+	}
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+// format frames the message, the stream transports need a trailing newline
+func (s *syslogSink) format(severity int, b []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>%s %s[%d]: ", syslogDaemon|severity, time.Now().Format(time.Stamp), s.tag, os.Getpid())
+	buf.Write(b)
+	switch s.network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
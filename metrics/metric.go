@@ -0,0 +1,201 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are the default histogram buckets in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// value is a float64 that is updated atomically
+type value struct {
+	bits uint64
+}
+
+func (v *value) add(f float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		n := math.Float64bits(math.Float64frombits(old) + f)
+		if atomic.CompareAndSwapUint64(&v.bits, old, n) {
+			return
+		}
+	}
+}
+
+func (v *value) set(f float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(f))
+}
+
+func (v *value) get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	v value
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+// Add adds a non-negative value to the counter
+func (c *Counter) Add(f float64) {
+	if f > 0 {
+		c.v.add(f)
+	}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	v value
+}
+
+// Set sets the gauge to the value
+func (g *Gauge) Set(f float64) {
+	g.v.set(f)
+}
+
+// Inc increments the gauge by one
+func (g *Gauge) Inc() {
+	g.v.add(1)
+}
+
+// Dec decrements the gauge by one
+func (g *Gauge) Dec() {
+	g.v.add(-1)
+}
+
+// Add adds the value to the gauge
+func (g *Gauge) Add(f float64) {
+	g.v.add(f)
+}
+
+// Histogram counts the observed values in buckets
+type Histogram struct {
+	upper  []float64
+	counts []uint64
+	count  uint64
+	sum    value
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{upper: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe adds a value to the histogram
+func (h *Histogram) Observe(f float64) {
+	if i := sort.SearchFloat64s(h.upper, f); i < len(h.upper) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+	atomic.AddUint64(&h.count, 1)
+	h.sum.add(f)
+}
+
+// vec keeps the metrics of a family by their label values
+type vec struct {
+	labels []string
+	mu     sync.RWMutex
+	values map[string]interface{}
+	create func() interface{}
+}
+
+func newVec(labels []string, create func() interface{}) *vec {
+	return &vec{labels: labels, values: make(map[string]interface{}), create: create}
+}
+
+func (v *vec) with(vals []string) interface{} {
+	if len(vals) != len(v.labels) {
+		panic("metrics: inconsistent label cardinality")
+	}
+	key := strings.Join(vals, "\xff")
+	v.mu.RLock()
+	o, ok := v.values[key]
+	v.mu.RUnlock()
+	if ok {
+		return o
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if o, ok := v.values[key]; ok {
+		return o
+	}
+	o = v.create()
+	v.values[key] = o
+	return o
+}
+
+// each calls fn with the label values and the metric in a stable order
+func (v *vec) each(fn func(vals []string, o interface{})) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	v.mu.RUnlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v.mu.RLock()
+		o := v.values[key]
+		v.mu.RUnlock()
+		var vals []string
+		if len(v.labels) > 0 {
+			vals = strings.Split(key, "\xff")
+		}
+		fn(vals, o)
+	}
+}
+
+// CounterVec is a family of counters partitioned by labels
+type CounterVec struct {
+	*vec
+}
+
+// WithLabelValues returns the counter of the label values
+func (c *CounterVec) WithLabelValues(vals ...string) *Counter {
+	return c.with(vals).(*Counter)
+}
+
+// GaugeVec is a family of gauges partitioned by labels
+type GaugeVec struct {
+	*vec
+}
+
+// WithLabelValues returns the gauge of the label values
+func (g *GaugeVec) WithLabelValues(vals ...string) *Gauge {
+	return g.with(vals).(*Gauge)
+}
+
+// HistogramVec is a family of histograms partitioned by labels
+type HistogramVec struct {
+	*vec
+	buckets []float64
+}
+
+// WithLabelValues returns the histogram of the label values
+func (h *HistogramVec) WithLabelValues(vals ...string) *Histogram {
+	return h.with(vals).(*Histogram)
+}
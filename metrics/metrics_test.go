@@ -0,0 +1,100 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package metrics_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/samuelngs/smartdns/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.NewCounterVec("queries_total", "Queries.", "qtype", "rcode")
+	c.WithLabelValues("A", "NOERROR").Inc()
+	c.WithLabelValues("A", "NOERROR").Add(2)
+	c.WithLabelValues("TXT", `"quoted"`).Inc()
+	c.WithLabelValues("TXT", "NXDOMAIN").Add(-1)
+
+	var b bytes.Buffer
+	r.WriteTo(&b)
+	assert.Equal(t, strings.Join([]string{
+		"# HELP queries_total Queries.",
+		"# TYPE queries_total counter",
+		`queries_total{qtype="A",rcode="NOERROR"} 3`,
+		`queries_total{qtype="TXT",rcode="\"quoted\""} 1`,
+		`queries_total{qtype="TXT",rcode="NXDOMAIN"} 0`,
+		"",
+	}, "\n"), b.String())
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := metrics.NewRegistry()
+	h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1})
+	h.WithLabelValues().Observe(0.05)
+	h.WithLabelValues().Observe(0.1)
+	h.WithLabelValues().Observe(0.5)
+	h.WithLabelValues().Observe(5)
+
+	var b bytes.Buffer
+	r.WriteTo(&b)
+	assert.Equal(t, strings.Join([]string{
+		"# HELP latency_seconds Latency.",
+		"# TYPE latency_seconds histogram",
+		`latency_seconds_bucket{le="0.1"} 2`,
+		`latency_seconds_bucket{le="1"} 3`,
+		`latency_seconds_bucket{le="+Inf"} 4`,
+		"latency_seconds_sum 5.65",
+		"latency_seconds_count 4",
+		"",
+	}, "\n"), b.String())
+}
+
+func TestGaugeFunc(t *testing.T) {
+	r := metrics.NewRegistry()
+	g := r.NewGaugeVec("b_active", "Active.")
+	g.WithLabelValues().Inc()
+	g.WithLabelValues().Inc()
+	g.WithLabelValues().Dec()
+	r.NewGaugeFunc("a_usage", "Usage.", func() []metrics.Sample {
+		return []metrics.Sample{{LabelValues: []string{"alice"}, Value: 1024}}
+	}, "user")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Header().Get("Content-Type"), "version=0.0.4")
+	assert.Equal(t, strings.Join([]string{
+		"# HELP a_usage Usage.",
+		"# TYPE a_usage gauge",
+		`a_usage{user="alice"} 1024`,
+		"# HELP b_active Active.",
+		"# TYPE b_active gauge",
+		"b_active 1",
+		"",
+	}, "\n"), rec.Body.String())
+}
+
+func TestRegisterTwice(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.NewCounterVec("queries_total", "Queries.")
+	assert.Panics(t, func() { r.NewCounterVec("queries_total", "Queries.") })
+	assert.Panics(t, func() { r.NewCounterVec("other_total", "Other.", "a").WithLabelValues("a", "b") })
+}
@@ -0,0 +1,242 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultRegistry is the registry the package level constructors register to
+var DefaultRegistry = NewRegistry()
+
+// Sample is a value of a metric that is collected on demand
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type family struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+	vec    *vec
+	fn     func() []Sample
+}
+
+// Registry holds the metric families exposed together
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+func (r *Registry) register(f *family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.families[f.name]; ok {
+		panic(fmt.Sprintf("metrics: %q is already registered", f.name))
+	}
+	r.families[f.name] = f
+}
+
+// NewCounterVec registers a family of counters
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := newVec(labels, func() interface{} { return new(Counter) })
+	r.register(&family{name: name, help: help, typ: "counter", labels: labels, vec: v})
+	return &CounterVec{v}
+}
+
+// NewGaugeVec registers a family of gauges
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := newVec(labels, func() interface{} { return new(Gauge) })
+	r.register(&family{name: name, help: help, typ: "gauge", labels: labels, vec: v})
+	return &GaugeVec{v}
+}
+
+// NewHistogramVec registers a family of histograms with the upper bounds of
+// the buckets in increasing order
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	v := newVec(labels, func() interface{} { return newHistogram(buckets) })
+	r.register(&family{name: name, help: help, typ: "histogram", labels: labels, vec: v})
+	return &HistogramVec{v, buckets}
+}
+
+// NewCounterFunc registers a family of counters whose values are collected
+// from fn when the metrics are written
+func (r *Registry) NewCounterFunc(name, help string, fn func() []Sample, labels ...string) {
+	r.register(&family{name: name, help: help, typ: "counter", labels: labels, fn: fn})
+}
+
+// NewGaugeFunc registers a family of gauges whose values are collected from
+// fn when the metrics are written
+func (r *Registry) NewGaugeFunc(name, help string, fn func() []Sample, labels ...string) {
+	r.register(&family{name: name, help: help, typ: "gauge", labels: labels, fn: fn})
+}
+
+// WriteTo writes the metrics in the prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+		if f.fn != nil {
+			for _, s := range f.fn() {
+				writeSample(bw, f.name, f.labels, s.LabelValues, "", "", s.Value)
+			}
+			continue
+		}
+		f.vec.each(func(vals []string, o interface{}) {
+			switch m := o.(type) {
+			case *Counter:
+				writeSample(bw, f.name, f.labels, vals, "", "", m.v.get())
+			case *Gauge:
+				writeSample(bw, f.name, f.labels, vals, "", "", m.v.get())
+			case *Histogram:
+				var cumulative uint64
+				for i, upper := range m.upper {
+					cumulative += atomic.LoadUint64(&m.counts[i])
+					writeSample(bw, f.name+"_bucket", f.labels, vals, "le", formatFloat(upper), float64(cumulative))
+				}
+				count := atomic.LoadUint64(&m.count)
+				writeSample(bw, f.name+"_bucket", f.labels, vals, "le", "+Inf", float64(count))
+				writeSample(bw, f.name+"_sum", f.labels, vals, "", "", m.sum.get())
+				writeSample(bw, f.name+"_count", f.labels, vals, "", "", float64(count))
+			}
+		})
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP exposes the metrics of the registry
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+func writeSample(w *bufio.Writer, name string, labels, vals []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || len(extraLabel) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label)
+			w.WriteString(`="`)
+			w.WriteString(escapeLabel(vals[i]))
+			w.WriteByte('"')
+		}
+		if len(extraLabel) > 0 {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraLabel)
+			w.WriteString(`="`)
+			w.WriteString(extraValue)
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewCounterVec registers a family of counters to the default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return DefaultRegistry.NewCounterVec(name, help, labels...)
+}
+
+// NewGaugeVec registers a family of gauges to the default registry
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return DefaultRegistry.NewGaugeVec(name, help, labels...)
+}
+
+// NewHistogramVec registers a family of histograms to the default registry
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return DefaultRegistry.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// NewCounterFunc registers a family of collected counters to the default registry
+func NewCounterFunc(name, help string, fn func() []Sample, labels ...string) {
+	DefaultRegistry.NewCounterFunc(name, help, fn, labels...)
+}
+
+// NewGaugeFunc registers a family of collected gauges to the default registry
+func NewGaugeFunc(name, help string, fn func() []Sample, labels ...string) {
+	DefaultRegistry.NewGaugeFunc(name, help, fn, labels...)
+}
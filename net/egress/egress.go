@@ -0,0 +1,55 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package egress
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Dialer connects to an address, either directly or through an upstream proxy
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Auth contains the credentials of an upstream proxy
+type Auth struct {
+	Username string
+	Password string
+}
+
+// Direct returns a dialer that connects to the address directly
+func Direct() Dialer {
+	return new(net.Dialer)
+}
+
+func dialWithDeadline(ctx context.Context, forward Dialer, addr string, handshake func(net.Conn) error) (net.Conn, error) {
+	c, err := forward.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	if err := handshake(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.SetDeadline(time.Time{})
+	return c, nil
+}
@@ -0,0 +1,219 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package egress_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/smartdns/net/egress"
+	"github.com/stretchr/testify/assert"
+)
+
+func listen(t *testing.T, handle func(net.Conn)) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				handle(c)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// echo is the destination the upstream proxies connect to
+func echo(t *testing.T) string {
+	return listen(t, func(c net.Conn) { io.Copy(c, c) })
+}
+
+// socks5Server is a minimal SOCKS5 stand-in that only accepts the given
+// credentials and resolves "echo.test" to the echo server
+func socks5Server(t *testing.T, user, pass, target string) string {
+	return listen(t, func(c net.Conn) {
+		hdr := make([]byte, 2)
+		io.ReadFull(c, hdr)
+		io.ReadFull(c, make([]byte, hdr[1]))
+		c.Write([]byte{5, 2})
+
+		io.ReadFull(c, hdr)
+		u := make([]byte, hdr[1])
+		io.ReadFull(c, u)
+		io.ReadFull(c, hdr[:1])
+		p := make([]byte, hdr[0])
+		io.ReadFull(c, p)
+		if string(u) != user || string(p) != pass {
+			c.Write([]byte{1, 1})
+			return
+		}
+		c.Write([]byte{1, 0})
+
+		req := make([]byte, 5)
+		io.ReadFull(c, req)
+		name := make([]byte, req[4]+2)
+		io.ReadFull(c, name)
+		port := binary.BigEndian.Uint16(name[len(name)-2:])
+		if string(name[:len(name)-2]) != "echo.test" {
+			c.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		_, tport, _ := net.SplitHostPort(target)
+		if strconv.Itoa(int(port)) != tport {
+			c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		dst, err := net.Dial("tcp", target)
+		if err != nil {
+			c.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		defer dst.Close()
+		c.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+		go io.Copy(dst, c)
+		io.Copy(c, dst)
+	})
+}
+
+// connectServer is a minimal HTTP CONNECT stand-in
+func connectServer(t *testing.T) string {
+	return listen(t, func(c net.Conn) {
+		req, err := http.ReadRequest(bufio.NewReader(c))
+		if err != nil || req.Method != http.MethodConnect {
+			c.Write([]byte("HTTP/1.1 405 Method Not Allowed\r\n\r\n"))
+			return
+		}
+		dst, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			c.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+			return
+		}
+		defer dst.Close()
+		c.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go io.Copy(dst, c)
+		io.Copy(c, dst)
+	})
+}
+
+func roundtrip(t *testing.T, d egress.Dialer, addr string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	c.Write([]byte("hello"))
+	b := make([]byte, 5)
+	_, err = io.ReadFull(c, b)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+}
+
+func TestSOCKS5(t *testing.T) {
+	target := echo(t)
+	_, port, _ := net.SplitHostPort(target)
+	proxy := socks5Server(t, "user", "pass", target)
+
+	d := egress.SOCKS5(proxy, &egress.Auth{Username: "user", Password: "pass"}, nil)
+	roundtrip(t, d, net.JoinHostPort("echo.test", port))
+
+	d = egress.SOCKS5(proxy, &egress.Auth{Username: "user", Password: "wrong"}, nil)
+	_, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("echo.test", port))
+	assert.Error(t, err)
+
+	d = egress.SOCKS5(proxy, nil, nil)
+	_, err = d.DialContext(context.Background(), "tcp", net.JoinHostPort("echo.test", port))
+	assert.Error(t, err)
+}
+
+func TestHTTPConnect(t *testing.T) {
+	target := echo(t)
+	roundtrip(t, egress.HTTPConnect(connectServer(t), nil, nil), target)
+}
+
+func TestChain(t *testing.T) {
+	target := echo(t)
+	_, port, _ := net.SplitHostPort(target)
+
+	// the connection goes through the http proxy to reach the socks5 proxy
+	d := egress.HTTPConnect(connectServer(t), nil, nil)
+	d = egress.SOCKS5(socks5Server(t, "user", "pass", target), &egress.Auth{Username: "user", Password: "pass"}, d)
+	roundtrip(t, d, net.JoinHostPort("echo.test", port))
+}
+
+func TestSourcePool(t *testing.T) {
+	a, b := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+	v6 := net.ParseIP("2001:db8::1")
+	client := net.ParseIP("198.51.100.7")
+
+	rr := egress.NewSourcePool([]net.IP{a, b, v6}, "", false)
+	assert.Equal(t, a, rr.Pick(client, net.ParseIP("203.0.113.1")))
+	assert.Equal(t, b, rr.Pick(client, net.ParseIP("203.0.113.1")))
+	assert.Equal(t, v6, rr.Pick(client, net.ParseIP("2001:db8::2")))
+
+	sticky := egress.NewSourcePool([]net.IP{a, b}, "", true)
+	first := sticky.Pick(client, nil)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, sticky.Pick(client, nil))
+	}
+	assert.Nil(t, sticky.Pick(client, net.ParseIP("2001:db8::2")))
+}
+
+func TestSourcePoolDialer(t *testing.T) {
+	target := echo(t)
+	pool := egress.NewSourcePool([]net.IP{net.ParseIP("127.0.0.1")}, "", false)
+	roundtrip(t, pool.Dialer(nil, net.ParseIP("127.0.0.1")), target)
+
+	// a destination of another family is not dialed from the default address
+	_, err := pool.Dialer(nil, net.ParseIP("::1")).DialContext(context.Background(), "tcp", "[::1]:443")
+	assert.Equal(t, egress.ErrNoSourceAddress, err)
+}
+
+func TestDialParallel(t *testing.T) {
+	target := echo(t)
+	_, port, _ := net.SplitHostPort(target)
+
+	addrs := []net.IP{net.ParseIP("::1"), net.ParseIP("192.0.2.1"), net.ParseIP("127.0.0.1")}
+	c, err := egress.DialParallel(context.Background(), addrs, time.Millisecond*10, func(ctx context.Context, ip net.IP) (net.Conn, error) {
+		if !ip.Equal(net.ParseIP("127.0.0.1")) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return new(net.Dialer).DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+	})
+	if assert.NoError(t, err) {
+		c.Close()
+	}
+
+	_, err = egress.DialParallel(context.Background(), nil, time.Millisecond, nil)
+	assert.Error(t, err)
+}
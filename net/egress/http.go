@@ -0,0 +1,99 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package egress
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// maxResponseHeaderSize limits the size of the CONNECT response header
+const maxResponseHeaderSize = 1 << 13
+
+type httpConnect struct {
+	addr    string
+	auth    *Auth
+	forward Dialer
+}
+
+// HTTPConnect returns a dialer that connects to the address through a HTTP
+// proxy with CONNECT method, the hostname is resolved by the proxy server
+func HTTPConnect(addr string, auth *Auth, forward Dialer) Dialer {
+	if forward == nil {
+		forward = Direct()
+	}
+	return &httpConnect{addr, auth, forward}
+}
+
+func (h *httpConnect) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("http connect: unsupported network %q", network)
+	}
+	return dialWithDeadline(ctx, h.forward, h.addr, func(c net.Conn) error {
+		if err := h.connect(c, addr); err != nil {
+			return fmt.Errorf("http connect: %v", err)
+		}
+		return nil
+	})
+}
+
+func (h *httpConnect) connect(c net.Conn, addr string) error {
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "CONNECT %s HTTP/1.1\r\n", addr)
+	fmt.Fprintf(&req, "Host: %s\r\n", addr)
+	if h.auth != nil {
+		cred := base64.StdEncoding.EncodeToString([]byte(h.auth.Username + ":" + h.auth.Password))
+		fmt.Fprintf(&req, "Proxy-Authorization: Basic %s\r\n", cred)
+	}
+	req.WriteString("\r\n")
+	if _, err := c.Write(req.Bytes()); err != nil {
+		return fmt.Errorf("could not write request: %v", err)
+	}
+
+	// the response header is read byte by byte so that no data sent by the
+	// destination after the header is consumed
+	var (
+		resp []byte
+		b    [1]byte
+	)
+	for !bytes.HasSuffix(resp, []byte("\r\n\r\n")) {
+		if len(resp) >= maxResponseHeaderSize {
+			return errors.New("response header too large")
+		}
+		if _, err := c.Read(b[:]); err != nil {
+			return fmt.Errorf("could not read response: %v", err)
+		}
+		resp = append(resp, b[0])
+	}
+
+	status := string(resp[:bytes.IndexByte(resp, '\n')])
+	parts := strings.SplitN(strings.TrimSpace(status), " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "HTTP/") {
+		return fmt.Errorf("malformed response %q", status)
+	}
+	if parts[1] != "200" {
+		return fmt.Errorf("connect to %q failed: %s", addr, strings.Join(parts[1:], " "))
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package egress
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// DefaultFallbackDelay is the delay before the next connection attempt is
+// started, as recommended by RFC 8305
+const DefaultFallbackDelay = 250 * time.Millisecond
+
+// DialParallel connects to the first reachable address with the happy eyeballs
+// algorithm described in RFC 8305, the addresses are interleaved by family and
+// each attempt starts once the previous one failed or the delay elapsed
+func DialParallel(ctx context.Context, addrs []net.IP, delay time.Duration, dial func(context.Context, net.IP) (net.Conn, error)) (net.Conn, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no address to dial")
+	}
+	addrs = interleave(addrs)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		c   net.Conn
+		err error
+	}
+	results := make(chan result, len(addrs))
+
+	var next, pending int
+	start := func() {
+		ip := addrs[next]
+		next++
+		pending++
+		go func() {
+			c, err := dial(ctx, ip)
+			results <- result{c, err}
+		}()
+	}
+	start()
+
+	var err error
+	for pending > 0 {
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		if next < len(addrs) {
+			timer = time.NewTimer(delay)
+			timeout = timer.C
+		}
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// close the connections of the attempts that are still running
+				go func(n int) {
+					for i := 0; i < n; i++ {
+						if o := <-results; o.c != nil {
+							o.c.Close()
+						}
+					}
+				}(pending)
+				if timer != nil {
+					timer.Stop()
+				}
+				return r.c, nil
+			}
+			err = r.err
+			if next < len(addrs) {
+				start()
+			}
+		case <-timeout:
+			start()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	return nil, err
+}
+
+// interleave alternates the address families, starting with the family of
+// the first address
+func interleave(addrs []net.IP) []net.IP {
+	var primary, secondary []net.IP
+	first := addrs[0].To4() != nil
+	for _, addr := range addrs {
+		if (addr.To4() != nil) == first {
+			primary = append(primary, addr)
+		} else {
+			secondary = append(secondary, addr)
+		}
+	}
+	out := make([]net.IP, 0, len(addrs))
+	for i := 0; i < len(primary) || i < len(secondary); i++ {
+		if i < len(primary) {
+			out = append(out, primary[i])
+		}
+		if i < len(secondary) {
+			out = append(out, secondary[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package egress
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+const (
+	socks5Version        = 0x05
+	socks5AuthNone       = 0x00
+	socks5AuthPassword   = 0x02
+	socks5AuthNoAccepted = 0xff
+	socks5CmdConnect     = 0x01
+	socks5AddrIPv4       = 0x01
+	socks5AddrDomain     = 0x03
+	socks5AddrIPv6       = 0x04
+)
+
+type socks5 struct {
+	addr    string
+	auth    *Auth
+	forward Dialer
+}
+
+// SOCKS5 returns a dialer that connects to the address through a SOCKS5
+// proxy, the hostname is resolved by the proxy server
+func SOCKS5(addr string, auth *Auth, forward Dialer) Dialer {
+	if forward == nil {
+		forward = Direct()
+	}
+	return &socks5{addr, auth, forward}
+}
+
+func (s *socks5) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("socks5: unsupported network %q", network)
+	}
+	return dialWithDeadline(ctx, s.forward, s.addr, func(c net.Conn) error {
+		if err := s.negotiate(c); err != nil {
+			return fmt.Errorf("socks5: %v", err)
+		}
+		if err := s.connect(c, addr); err != nil {
+			return fmt.Errorf("socks5: %v", err)
+		}
+		return nil
+	})
+}
+
+func (s *socks5) negotiate(c net.Conn) error {
+	methods := []byte{socks5AuthNone}
+	if s.auth != nil {
+		methods = append(methods, socks5AuthPassword)
+	}
+	req := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := c.Write(req); err != nil {
+		return fmt.Errorf("could not write greeting: %v", err)
+	}
+
+	var resp [2]byte
+	if _, err := io.ReadFull(c, resp[:]); err != nil {
+		return fmt.Errorf("could not read greeting: %v", err)
+	}
+	if resp[0] != socks5Version {
+		return fmt.Errorf("unexpected protocol version %d", resp[0])
+	}
+
+	switch resp[1] {
+	case socks5AuthNone:
+		return nil
+	case socks5AuthPassword:
+		if s.auth == nil {
+			return errors.New("proxy requires authentication")
+		}
+		if len(s.auth.Username) > 255 || len(s.auth.Password) > 255 {
+			return errors.New("username or password is too long")
+		}
+		req := []byte{0x01, byte(len(s.auth.Username))}
+		req = append(req, s.auth.Username...)
+		req = append(req, byte(len(s.auth.Password)))
+		req = append(req, s.auth.Password...)
+		if _, err := c.Write(req); err != nil {
+			return fmt.Errorf("could not write credentials: %v", err)
+		}
+		if _, err := io.ReadFull(c, resp[:]); err != nil {
+			return fmt.Errorf("could not read authentication status: %v", err)
+		}
+		if resp[1] != 0x00 {
+			return errors.New("authentication failed")
+		}
+		return nil
+	case socks5AuthNoAccepted:
+		return errors.New("no acceptable authentication methods")
+	default:
+		return fmt.Errorf("unsupported authentication method %d", resp[1])
+	}
+}
+
+func (s *socks5) connect(c net.Conn, addr string) error {
+	host, sport, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(sport, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", sport)
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0x00}
+	switch ip := net.ParseIP(host); {
+	case ip != nil && ip.To4() != nil:
+		req = append(req, socks5AddrIPv4)
+		req = append(req, ip.To4()...)
+	case ip != nil:
+		req = append(req, socks5AddrIPv6)
+		req = append(req, ip.To16()...)
+	case len(host) > 255:
+		return fmt.Errorf("hostname %q is too long", host)
+	default:
+		req = append(req, socks5AddrDomain, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], uint16(port))
+	if _, err := c.Write(req); err != nil {
+		return fmt.Errorf("could not write connect request: %v", err)
+	}
+
+	var resp [4]byte
+	if _, err := io.ReadFull(c, resp[:]); err != nil {
+		return fmt.Errorf("could not read connect reply: %v", err)
+	}
+	if resp[0] != socks5Version {
+		return fmt.Errorf("unexpected protocol version %d", resp[0])
+	}
+	if resp[1] != 0x00 {
+		return fmt.Errorf("connect to %q failed with code %d", addr, resp[1])
+	}
+
+	// skip the bound address and port
+	var sz int
+	switch resp[3] {
+	case socks5AddrIPv4:
+		sz = net.IPv4len
+	case socks5AddrIPv6:
+		sz = net.IPv6len
+	case socks5AddrDomain:
+		var l [1]byte
+		if _, err := io.ReadFull(c, l[:]); err != nil {
+			return fmt.Errorf("could not read bound address: %v", err)
+		}
+		sz = int(l[0])
+	default:
+		return fmt.Errorf("unknown address type %d", resp[3])
+	}
+	if _, err := io.ReadFull(c, make([]byte, sz+2)); err != nil {
+		return fmt.Errorf("could not read bound address: %v", err)
+	}
+	return nil
+}
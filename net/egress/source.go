@@ -0,0 +1,105 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package egress
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"net"
+	"sync/atomic"
+	"syscall"
+)
+
+// ErrNoSourceAddress is returned when dialing a destination of an address
+// family the source pool has no address of
+var ErrNoSourceAddress = errors.New("no source address of the destination address family")
+
+// SourcePool picks the local address and network interface that outbound
+// connections are bound to
+type SourcePool struct {
+	addrs  []net.IP
+	iface  string
+	sticky bool
+	next   uint32
+}
+
+// NewSourcePool creates a pool of local addresses, addresses are picked in
+// round-robin order unless sticky is set, in which case a client is always
+// bound to the same address
+func NewSourcePool(addrs []net.IP, iface string, sticky bool) *SourcePool {
+	return &SourcePool{addrs: addrs, iface: iface, sticky: sticky}
+}
+
+// Pick returns a local address for the client, only addresses of the same
+// family as dst are considered when dst is known
+func (p *SourcePool) Pick(client, dst net.IP) net.IP {
+	addrs := p.addrs
+	if dst != nil {
+		addrs = make([]net.IP, 0, len(p.addrs))
+		for _, addr := range p.addrs {
+			if (addr.To4() != nil) == (dst.To4() != nil) {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return nil
+	}
+	if p.sticky && client != nil {
+		h := fnv.New32a()
+		h.Write(client.To16())
+		return addrs[h.Sum32()%uint32(len(addrs))]
+	}
+	n := atomic.AddUint32(&p.next, 1) - 1
+	return addrs[n%uint32(len(addrs))]
+}
+
+// Dialer returns a direct dialer bound to a local address picked for the
+// client and the destination, the dialer fails with ErrNoSourceAddress
+// rather than leaving from the default address when there is none to pick
+func (p *SourcePool) Dialer(client, dst net.IP) Dialer {
+	d := new(net.Dialer)
+	if p == nil {
+		return d
+	}
+	if addr := p.Pick(client, dst); addr != nil {
+		d.LocalAddr = &net.TCPAddr{IP: addr}
+	} else if len(p.addrs) > 0 {
+		return failDialer{ErrNoSourceAddress}
+	}
+	if len(p.iface) > 0 {
+		iface := p.iface
+		d.Control = func(network, address string, c syscall.RawConn) error {
+			var err error
+			if cerr := c.Control(func(fd uintptr) { err = bindToDevice(fd, iface) }); cerr != nil {
+				return cerr
+			}
+			return err
+		}
+	}
+	return d
+}
+
+// failDialer is a dialer that always fails with the error
+type failDialer struct {
+	err error
+}
+
+func (d failDialer) DialContext(context.Context, string, string) (net.Conn, error) {
+	return nil, d.err
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package https
+
+import "fmt"
+
+// Defines the TLS protocol versions
+const (
+	VersionSSL30 = 0x0300
+	VersionTLS10 = 0x0301
+	VersionTLS11 = 0x0302
+	VersionTLS12 = 0x0303
+	VersionTLS13 = 0x0304
+)
+
+// Defines the types of the extensions of a ClientHello that are parsed
+const (
+	ExtensionServerName          = 0
+	ExtensionSupportedGroups     = 10
+	ExtensionPointFormats        = 11
+	ExtensionSignatureAlgorithms = 13
+	ExtensionALPN                = 16
+	ExtensionSupportedVersions   = 43
+	ExtensionKeyShare            = 51
+	ExtensionECH                 = 0xfe0d
+)
+
+// ClientHello is the first message of a TLS handshake, the lists keep the
+// order and the GREASE values sent by the client
+type ClientHello struct {
+	// Version is the legacy_version of the message, the clients that
+	// support TLS 1.3 send TLS 1.2 and list the versions in
+	// SupportedVersions
+	Version            uint16
+	CipherSuites       []uint16
+	CompressionMethods []uint8
+	// Extensions are the types of the extensions in the order they were
+	// sent
+	Extensions          []uint16
+	ServerName          string
+	ALPN                []string
+	SupportedVersions   []uint16
+	SupportedGroups     []uint16
+	PointFormats        []uint8
+	SignatureAlgorithms []uint16
+	// KeyShareGroups are the groups of the key shares sent by the client
+	KeyShareGroups []uint16
+	// ECH reports whether the encrypted_client_hello extension was sent,
+	// the ServerName is then the public name of the client-facing server
+	ECH bool
+}
+
+// TLSVersion returns the highest version offered by the client
+func (c *ClientHello) TLSVersion() uint16 {
+	var v uint16
+	for _, sv := range c.SupportedVersions {
+		if !IsGREASE(sv) && sv > v {
+			v = sv
+		}
+	}
+	if v == 0 {
+		return c.Version
+	}
+	return v
+}
+
+// HasExtension reports whether the client sent the extension
+func (c *ClientHello) HasExtension(typ uint16) bool {
+	for _, e := range c.Extensions {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGREASE reports whether the value is one of the reserved values clients
+// send to keep the servers tolerant of unknown values, see RFC 8701
+func IsGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// VersionName returns the name of the TLS version
+func VersionName(v uint16) string {
+	switch v {
+	case VersionSSL30:
+		return "SSL 3.0"
+	case VersionTLS10:
+		return "TLS 1.0"
+	case VersionTLS11:
+		return "TLS 1.1"
+	case VersionTLS12:
+		return "TLS 1.2"
+	case VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04x", v)
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package https_test
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/smartdns/net/https"
+	"github.com/stretchr/testify/assert"
+)
+
+// readHandshake sends the ClientHello of a crypto/tls client with the config
+// and parses it like the sni-proxy does
+func readHandshake(t *testing.T, conf *tls.Config) (*https.Handshake, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(time.Second))
+		tls.Client(c, conf).Handshake()
+	}()
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(time.Second))
+
+	// the sni-proxy reads the content type to detect the protocol
+	f := make([]byte, 1)
+	if _, err := c.Read(f); err != nil {
+		t.Fatal(err)
+	}
+	return https.ParseHandshakeMessage(c.(*net.TCPConn))
+}
+
+func TestParseClientHello(t *testing.T) {
+	m, err := readHandshake(t, &tls.Config{
+		ServerName:       "netflix.com",
+		NextProtos:       []string{"h2", "http/1.1"},
+		MinVersion:       tls.VersionTLS12,
+		MaxVersion:       tls.VersionTLS13,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	hello := m.ClientHello
+	assert.Equal(t, "netflix.com", m.Hostname)
+	assert.Equal(t, []string{"h2", "http/1.1"}, m.ALPN)
+	assert.Equal(t, "netflix.com", hello.ServerName)
+	assert.Equal(t, uint16(https.VersionTLS12), hello.Version)
+	assert.Equal(t, []uint16{https.VersionTLS13, https.VersionTLS12}, hello.SupportedVersions)
+	assert.Equal(t, uint16(https.VersionTLS13), hello.TLSVersion())
+	assert.Contains(t, hello.CipherSuites, tls.TLS_AES_128_GCM_SHA256)
+	assert.Contains(t, hello.CipherSuites, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)
+	assert.Equal(t, []uint8{0}, hello.CompressionMethods)
+	assert.Contains(t, hello.SupportedGroups, uint16(tls.X25519))
+	assert.Contains(t, hello.SupportedGroups, uint16(tls.CurveP256))
+	assert.Contains(t, hello.KeyShareGroups, uint16(tls.X25519))
+	assert.Contains(t, hello.SignatureAlgorithms, uint16(tls.ECDSAWithP256AndSHA256))
+	assert.Equal(t, []uint8{0}, hello.PointFormats)
+	assert.True(t, hello.HasExtension(https.ExtensionServerName))
+	assert.True(t, hello.HasExtension(https.ExtensionKeyShare))
+	assert.False(t, hello.ECH)
+	assert.Equal(t, byte(22), m.Buffer.Bytes()[0])
+}
+
+func TestParseClientHelloTLS12(t *testing.T) {
+	m, err := readHandshake(t, &tls.Config{
+		ServerName: "example.com",
+		MaxVersion: tls.VersionTLS12,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	hello := m.ClientHello
+	assert.Equal(t, "example.com", hello.ServerName)
+	assert.Empty(t, hello.ALPN)
+	assert.Equal(t, []uint16{https.VersionTLS12}, hello.SupportedVersions)
+	assert.Empty(t, hello.KeyShareGroups)
+	assert.Equal(t, uint16(https.VersionTLS12), hello.TLSVersion())
+	assert.False(t, hello.HasExtension(https.ExtensionALPN))
+}
+
+func TestGREASE(t *testing.T) {
+	for _, v := range []uint16{0x0a0a, 0x1a1a, 0x7a7a, 0xfafa} {
+		assert.True(t, https.IsGREASE(v), "%04x", v)
+	}
+	for _, v := range []uint16{0x0a1a, 0x0303, 0x1301, 0xfefe} {
+		assert.False(t, https.IsGREASE(v), "%04x", v)
+	}
+	hello := &https.ClientHello{Version: https.VersionTLS12, SupportedVersions: []uint16{0xdada, https.VersionTLS13}}
+	assert.Equal(t, "TLS 1.3", https.VersionName(hello.TLSVersion()))
+	assert.Equal(t, "0x7f1c", https.VersionName(0x7f1c))
+}
@@ -0,0 +1,41 @@
+//go:build gofuzz
+// +build gofuzz
+
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package https
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Fuzz is the entry point of go-fuzz, the records read from the data must be
+// kept in the buffer of the handshake exactly
+func Fuzz(data []byte) int {
+	h, err := ReadHandshake(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	if !bytes.HasPrefix(data, h.Buffer.Bytes()) {
+		panic(fmt.Sprintf("buffer %x is not a prefix of the data", h.Buffer.Bytes()))
+	}
+	if h.Hostname != h.ClientHello.ServerName {
+		panic("hostname differs from the server name of the hello")
+	}
+	return 1
+}
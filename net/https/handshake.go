@@ -25,25 +25,34 @@ import (
 // Handshake on a https request
 type Handshake struct {
 	Hostname string
-	Buffer   bytes.Buffer
+	// ALPN lists the application protocols offered by the client
+	ALPN []string
+	// ClientHello is the parsed ClientHello message
+	ClientHello *ClientHello
+	Buffer      bytes.Buffer
 }
 
-// ParseHandshakeMessage for parsing handshake metadata on a https request
+// ParseHandshakeMessage for parsing handshake metadata on a https request,
+// the content type of the first record was already read from the connection
 func ParseHandshakeMessage(c *net.TCPConn) (*Handshake, error) {
-	var buf bytes.Buffer
-	buf.WriteByte(22)
-
-	r := io.MultiReader(bytes.NewReader([]byte{22}), io.TeeReader(c, &buf))
-	hr := &handshakeReader{r: r}
+	return ReadHandshake(io.MultiReader(bytes.NewReader([]byte{contentTypeHandshake}), c))
+}
 
-	hostname, err := hr.ReadSNIHostname()
+// ReadHandshake reads the records of the ClientHello from r, the records
+// read are kept in the Buffer of the handshake and have to be forwarded
+// before the rest of the connection
+func ReadHandshake(r io.Reader) (*Handshake, error) {
+	h := new(Handshake)
+	msg, err := readHandshakeMessage(r, &h.Buffer)
 	if err != nil {
 		return nil, err
 	}
-
-	h := &Handshake{
-		Hostname: hostname,
-		Buffer:   buf,
+	hello, err := ParseClientHello(msg)
+	if err != nil {
+		return nil, err
 	}
+	h.Hostname = hello.ServerName
+	h.ALPN = hello.ALPN
+	h.ClientHello = hello
 	return h, nil
 }
@@ -17,181 +17,216 @@
 package https
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
-	"strings"
 )
 
 const (
+	recordHeaderSize     = 5
 	maxRecordSize        = 1 << 14
 	contentTypeHandshake = 22
 	handshakeTypeHello   = 1
-	extensionTypeSNI     = 0
 	nameTypeHostName     = 0
+	// maxHelloSize bounds the ClientHello reassembled from the records, the
+	// hellos with post-quantum key shares take a few kilobytes
+	maxHelloSize = 1 << 16
 )
 
-type handshakeReader struct {
-	r io.Reader
-	l int
-	e error
-}
-
-func (r *handshakeReader) RecordError(err error) {
-	if err != nil {
-		r.e = err
-	}
-}
-
-func (r *handshakeReader) Read(b []byte) (length int, err error) {
-	defer r.RecordError(err)
-	if r.e != nil {
-		return 0, r.e
-	}
-
-	if r.l == 0 {
-		typ, err := readUint8(r.r)
-		if err != nil {
-			return 0, fmt.Errorf("could not read record header: %v", err)
-		}
-		if typ != contentTypeHandshake {
-			return 0, fmt.Errorf("got wrong content type (wanted %d, got %d)", contentTypeHandshake, typ)
+// readHandshakeMessage reads the records of r until they hold a complete
+// handshake message, which may be split across records and reads. The bytes
+// of the records read are written to raw so that they can be forwarded.
+func readHandshakeMessage(r io.Reader, raw *bytes.Buffer) ([]byte, error) {
+	var msg []byte
+	hdr := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			return nil, fmt.Errorf("could not read record header: %v", err)
 		}
-		if err := skip(r.r, 2); err != nil {
-			return 0, fmt.Errorf("could not read record header: %v", err)
+		raw.Write(hdr)
+		if typ := hdr[0]; typ != contentTypeHandshake {
+			return nil, fmt.Errorf("got wrong content type (wanted %d, got %d)", contentTypeHandshake, typ)
 		}
-		sz, err := readUint16(r.r)
-		if err != nil {
-			return 0, fmt.Errorf("could not read record header: %v", err)
+		if hdr[1] != 3 {
+			return nil, fmt.Errorf("unsupported record version %d.%d", hdr[1], hdr[2])
 		}
+		sz := int(hdr[3])<<8 | int(hdr[4])
 		if sz > maxRecordSize {
-			return 0, fmt.Errorf("record too large (%d > %d)", sz, maxRecordSize)
+			return nil, fmt.Errorf("record too large (%d > %d)", sz, maxRecordSize)
 		}
-		r.l = int(sz)
-	}
+		if sz == 0 {
+			return nil, errors.New("empty handshake record")
+		}
+		if len(msg)+sz > maxHelloSize+4 {
+			return nil, fmt.Errorf("handshake message too large (> %d)", maxHelloSize)
+		}
+
+		n := len(msg)
+		msg = append(msg, make([]byte, sz)...)
+		if _, err := io.ReadFull(r, msg[n:]); err != nil {
+			return nil, fmt.Errorf("could not read record: %v", err)
+		}
+		raw.Write(msg[n:])
 
-	if len(b) > r.l {
-		b = b[:r.l]
+		if len(msg) < 4 {
+			continue
+		}
+		l := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+		if l > maxHelloSize {
+			return nil, fmt.Errorf("handshake message too large (%d > %d)", l, maxHelloSize)
+		}
+		if len(msg) >= 4+l {
+			// the rest of the record belongs to the next message
+			return msg[:4+l], nil
+		}
 	}
-	n, err := r.r.Read(b)
-	r.l -= n
-	return n, err
 }
 
-func (r *handshakeReader) ReadExtensions() (io.Reader, error) {
-	var rd io.Reader = r
-
-	typ, err := readUint8(rd)
-	if err != nil {
-		return nil, fmt.Errorf("could not read msg_type: %v", err)
+// ParseClientHello parses a handshake message holding a ClientHello
+func ParseClientHello(msg []byte) (*ClientHello, error) {
+	c := cursor(msg)
+	var typ uint8
+	var l uint32
+	if !c.readUint8(&typ) {
+		return nil, errors.New("could not read msg_type")
 	}
 	if typ != handshakeTypeHello {
 		return nil, fmt.Errorf("handshake message not a ClientHello (type %d, expected %d)", typ, handshakeTypeHello)
 	}
-
-	l, err := readUint24(rd)
-	if err != nil {
-		return nil, fmt.Errorf("could not read handshake message length: %v", err)
+	var body cursor
+	if !c.readUint24(&l) || !c.readBytes(int(l), (*[]byte)(&body)) {
+		return nil, errors.New("could not read handshake message")
 	}
-	rd = io.LimitReader(rd, int64(l))
 
-	// skip the protocol version (2 bytes)
-	if err := skip(rd, 2); err != nil {
-		return nil, fmt.Errorf("could not skip client_version: %v", err)
+	hello := new(ClientHello)
+	if !body.readUint16(&hello.Version) {
+		return nil, errors.New("could not read client_version")
 	}
 
 	// skip the clienthello.random (32 bytes, out of which 28 are suppose
 	// to be generated with a cryptographically strong number generator)
-	if err := skip(rd, 32); err != nil {
-		return nil, fmt.Errorf("could not skip random: %v", err)
+	if !body.skip(32) {
+		return nil, errors.New("could not skip random")
 	}
 
 	// the "session_id" (in case the client wants to resume a session in
 	// an abbreviated handshake, see below)
-	if err := skipVec8(rd); err != nil {
-		return nil, fmt.Errorf("could not skip session_id: %v", err)
+	var v cursor
+	if !body.readVec8(&v) {
+		return nil, errors.New("could not skip session_id")
 	}
 
-	// skip the list of "cipher suites" that the client knows of, ordered
-	// by client preference
-	if err := skipVec16(rd); err != nil {
-		return nil, fmt.Errorf("could not skip cipher_suites: %v", err)
+	// the list of "cipher suites" that the client knows of, ordered by
+	// client preference
+	if !body.readVec16(&v) || !v.readUint16s(&hello.CipherSuites) {
+		return nil, errors.New("could not read cipher_suites")
 	}
 
 	// the list of compression algorithms that the client knows of, ordered
 	// by client preference
-	if err := skipVec8(rd); err != nil {
-		return nil, fmt.Errorf("could not skip compression_methods: %v", err)
+	if !body.readVec8(&v) {
+		return nil, errors.New("could not read compression_methods")
 	}
+	hello.CompressionMethods = v
 
-	// read extensions
-	n, err := readUint16(rd)
-	if err != nil {
-		return nil, errors.New("no extension is available")
+	// the extensions are optional before TLS 1.3
+	if body.empty() {
+		return hello, nil
 	}
-	if err != nil {
-		return nil, fmt.Errorf("could not read extensions length: %v", err)
+	var exts cursor
+	if !body.readVec16(&exts) || !body.empty() {
+		return nil, errors.New("could not read extensions")
 	}
-
-	rd = io.LimitReader(rd, int64(n))
-	return rd, nil
+	for !exts.empty() {
+		var typ uint16
+		var data cursor
+		if !exts.readUint16(&typ) || !exts.readVec16(&data) {
+			return nil, errors.New("could not read extension")
+		}
+		hello.Extensions = append(hello.Extensions, typ)
+		if err := parseExtension(hello, typ, data); err != nil {
+			return nil, err
+		}
+	}
+	return hello, nil
 }
 
-func (r *handshakeReader) ReadSNIHostname() (string, error) {
-	rd, err := r.ReadExtensions()
-	if err != nil {
-		return "", err
-	}
-	for {
-		typ, err := readUint16(rd)
-		if err == io.EOF {
-			return "", errors.New("no SNI extension")
-		}
+// parseExtension parses the data of the extensions that are kept in the
+// ClientHello
+func parseExtension(hello *ClientHello, typ uint16, data cursor) error {
+	var v cursor
+	switch typ {
+	case ExtensionServerName:
+		name, err := parseServerName(data)
 		if err != nil {
-			return "", fmt.Errorf("could not read extension_type: %v", err)
+			return err
 		}
-		n, err := readUint16(rd)
-		if err != nil {
-			return "", fmt.Errorf("could not read extension_data length: %v", err)
+		hello.ServerName = name
+		return nil
+	case ExtensionALPN:
+		if !data.readVec16(&v) || !data.empty() {
+			return errors.New("could not read protocol_name_list")
 		}
-		if typ != extensionTypeSNI {
-			if err := skip(rd, int64(n)); err != nil {
-				return "", fmt.Errorf("could not skip extension_data: %v", err)
+		for !v.empty() {
+			var name cursor
+			if !v.readVec8(&name) || name.empty() {
+				return errors.New("could not read protocol_name")
 			}
-			continue
+			hello.ALPN = append(hello.ALPN, string(name))
 		}
-
-		er := io.LimitReader(rd, int64(n))
-		sl, err := readUint16(er)
-		if err != nil {
-			return "", fmt.Errorf("could not read server_name_list length: %v", err)
+		return nil
+	case ExtensionSupportedVersions:
+		if !data.readVec8(&v) || !v.readUint16s(&hello.SupportedVersions) {
+			return errors.New("could not read supported_versions")
 		}
-
-		er = io.LimitReader(rd, int64(sl))
-		for {
-			typ, err := readUint8(er)
-			if err == io.EOF {
-				return "", errors.New("SNI extension has no ServerName of type host_name")
-			}
-			if err != nil {
-				return "", fmt.Errorf("could not read name_type: %v", err)
-			}
-			if typ != nameTypeHostName {
-				if err := skipVec16(rd); err != nil {
-					return "", fmt.Errorf("could not skip server_name_list entry: %v", err)
-				}
-				continue
+	case ExtensionSupportedGroups:
+		if !data.readVec16(&v) || !v.readUint16s(&hello.SupportedGroups) {
+			return errors.New("could not read supported_groups")
+		}
+	case ExtensionPointFormats:
+		if !data.readVec8(&v) {
+			return errors.New("could not read ec_point_formats")
+		}
+		hello.PointFormats = v
+	case ExtensionSignatureAlgorithms:
+		if !data.readVec16(&v) || !v.readUint16s(&hello.SignatureAlgorithms) {
+			return errors.New("could not read signature_algorithms")
+		}
+	case ExtensionKeyShare:
+		if !data.readVec16(&v) {
+			return errors.New("could not read client_shares")
+		}
+		for !v.empty() {
+			var group uint16
+			var key cursor
+			if !v.readUint16(&group) || !v.readVec16(&key) {
+				return errors.New("could not read key_share entry")
 			}
+			hello.KeyShareGroups = append(hello.KeyShareGroups, group)
+		}
+	case ExtensionECH:
+		hello.ECH = true
+	}
+	return nil
+}
 
-			nl, err := readUint16(er)
-			if err != nil {
-				return "", fmt.Errorf("could not read host_name length: %v", err)
-			}
-			var b strings.Builder
-			if _, err := io.CopyN(&b, er, int64(nl)); err != nil {
-				return "", fmt.Errorf("could not read HostName: %v", err)
-			}
-			return b.String(), nil
+// parseServerName returns the host_name of the server_name_list, the names
+// of other types are skipped
+func parseServerName(data cursor) (string, error) {
+	var list cursor
+	if !data.readVec16(&list) || !data.empty() {
+		return "", errors.New("could not read server_name_list")
+	}
+	for !list.empty() {
+		var typ uint8
+		var name cursor
+		if !list.readUint8(&typ) || !list.readVec16(&name) {
+			return "", errors.New("could not read server_name_list entry")
+		}
+		if typ == nameTypeHostName {
+			return string(name), nil
 		}
 	}
+	return "", errors.New("SNI extension has no ServerName of type host_name")
 }
@@ -0,0 +1,261 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package https_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/samuelngs/smartdns/net/https"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixture returns the handshake message of the ClientHello in the hex file
+// of testdata
+func fixture(t *testing.T, name string) []byte {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name+".hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := hex.DecodeString(strings.Join(strings.Fields(string(b)), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// records frames the handshake message in records with fragments of the
+// size
+func records(msg []byte, size int) []byte {
+	var b []byte
+	for len(msg) > 0 {
+		n := size
+		if n > len(msg) {
+			n = len(msg)
+		}
+		b = append(b, 22, 3, 1, byte(n>>8), byte(n))
+		b = append(b, msg[:n]...)
+		msg = msg[n:]
+	}
+	return b
+}
+
+// vec16 prefixes the data with its 16-bit length
+func vec16(b ...byte) []byte {
+	return append([]byte{byte(len(b) >> 8), byte(len(b))}, b...)
+}
+
+// hello builds a ClientHello message with the extensions
+func hello(exts ...[]byte) []byte {
+	body := []byte{3, 3}
+	body = append(body, make([]byte, 32)...)
+	body = append(body, 0)
+	body = append(body, vec16(0x13, 0x01)...)
+	body = append(body, 1, 0)
+	var e []byte
+	for _, ext := range exts {
+		e = append(e, ext...)
+	}
+	body = append(body, vec16(e...)...)
+	return append([]byte{1, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// extension builds an extension of the type with the data
+func extension(typ uint16, data ...byte) []byte {
+	return append([]byte{byte(typ >> 8), byte(typ)}, vec16(data...)...)
+}
+
+func TestReadHandshake(t *testing.T) {
+	// testdata/README.md records where each hello comes from
+	captures := []struct {
+		name     string
+		hostname string
+		alpn     []string
+		version  uint16
+		groups   []uint16
+		ech      bool
+	}{
+		{
+			name:     "chrome-psk",
+			hostname: "edgeapi.slack.com",
+			alpn:     []string{"h2", "http/1.1"},
+			version:  https.VersionTLS13,
+			groups:   []uint16{0xdada, 0x001d},
+		},
+		{
+			name:     "chrome-alps",
+			hostname: "client.tlsfingerprint.io",
+			alpn:     []string{"h2", "http/1.1"},
+			version:  https.VersionTLS13,
+			groups:   []uint16{0x4a4a, 0x001d},
+		},
+		{
+			name:     "firefox",
+			hostname: "people-pa.clients6.google.com",
+			alpn:     []string{"h2", "http/1.1"},
+			version:  https.VersionTLS13,
+			groups:   []uint16{0x001d, 0x0017},
+		},
+		{
+			name:     "chrome-pq-synthetic",
+			hostname: "www.netflix.com",
+			alpn:     []string{"h2", "http/1.1"},
+			version:  https.VersionTLS13,
+			groups:   []uint16{0x7a7a, 0x6399, 0x001d},
+			ech:      true,
+		},
+		{
+			name:     "go-tls12",
+			hostname: "example.com",
+			version:  https.VersionTLS12,
+		},
+		{
+			name:     "go-long-hostname",
+			hostname: "a-very-long-label-that-is-not-too-long-for-dns-0123456789.example.com",
+			alpn:     []string{"h2", "http/1.1", "spdy/3", "acme-tls/1", "dot", "h3"},
+			version:  https.VersionTLS13,
+			groups:   []uint16{0x001d},
+		},
+	}
+	framings := []struct {
+		name string
+		size int
+	}{
+		{"one record", 1 << 14},
+		{"records of 1024 bytes", 1024},
+		{"records of 512 bytes", 512},
+		{"records of 100 bytes", 100},
+		{"records of 1 byte", 1},
+	}
+	readers := []struct {
+		name string
+		wrap func(io.Reader) io.Reader
+	}{
+		{"whole", func(r io.Reader) io.Reader { return r }},
+		{"one byte segments", iotest.OneByteReader},
+		{"half segments", iotest.HalfReader},
+	}
+	// the ChangeCipherSpec record that follows the hello must be left
+	// unread
+	next := []byte{20, 3, 3, 0, 1, 1}
+
+	for _, c := range captures {
+		msg := fixture(t, c.name)
+		for _, f := range framings {
+			for _, rd := range readers {
+				name := c.name + "/" + f.name + "/" + rd.name
+				raw := records(msg, f.size)
+				r := bytes.NewReader(append(append([]byte(nil), raw...), next...))
+				m, err := https.ReadHandshake(rd.wrap(r))
+				if !assert.NoError(t, err, name) {
+					continue
+				}
+				assert.Equal(t, c.hostname, m.Hostname, name)
+				assert.Equal(t, c.alpn, m.ALPN, name)
+				assert.Equal(t, c.version, m.ClientHello.TLSVersion(), name)
+				assert.Equal(t, c.ech, m.ClientHello.ECH, name)
+				if c.groups != nil {
+					assert.Equal(t, c.groups, m.ClientHello.KeyShareGroups, name)
+				}
+				assert.Equal(t, raw, m.Buffer.Bytes(), name)
+				rest, _ := ioutil.ReadAll(r)
+				assert.Equal(t, next, rest, name)
+			}
+		}
+	}
+}
+
+func TestReadHandshakeSharedRecord(t *testing.T) {
+	// the end of the record after the hello is forwarded with it
+	msg := append(hello(extension(0, vec16(append([]byte{0}, vec16([]byte("netflix.com")...)...)...)...)), 2, 0, 0, 0)
+	raw := records(msg, 1<<14)
+	m, err := https.ReadHandshake(bytes.NewReader(raw))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "netflix.com", m.Hostname)
+		assert.Equal(t, raw, m.Buffer.Bytes())
+	}
+}
+
+func TestParseServerName(t *testing.T) {
+	name := func(typ byte, s string) []byte {
+		return append([]byte{typ}, vec16([]byte(s)...)...)
+	}
+	list := append(name(1, "ignored-entry"), name(0, "netflix.com")...)
+	h, err := https.ParseClientHello(hello(extension(https.ExtensionServerName, vec16(list...)...)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "netflix.com", h.ServerName)
+	}
+
+	_, err = https.ParseClientHello(hello(extension(https.ExtensionServerName, vec16(name(1, "other")...)...)))
+	assert.Error(t, err)
+}
+
+func TestParseECH(t *testing.T) {
+	h, err := https.ParseClientHello(hello(extension(https.ExtensionECH, 0, 0, 1)))
+	if assert.NoError(t, err) {
+		assert.True(t, h.ECH)
+	}
+}
+
+func TestReadHandshakeErrors(t *testing.T) {
+	valid := hello(extension(https.ExtensionALPN, vec16(2, 'h', '2')...))
+	tooLong := records(append([]byte{1, 0x01, 0x00, 0x01}, make([]byte, 1<<14)...), 1<<14)
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"empty", nil},
+		{"application data", []byte{23, 3, 3, 0, 1, 0}},
+		{"sslv2 header", []byte{0x80, 0x2e, 1, 3, 1, 0}},
+		{"record too large", []byte{22, 3, 1, 0x40, 0x01}},
+		{"empty record", []byte{22, 3, 1, 0, 0}},
+		{"truncated record", records(valid, 1<<14)[:20]},
+		{"truncated message", records(valid[:len(valid)-1], 1<<14)},
+		{"message too large", tooLong},
+		{"not a client hello", records([]byte{2, 0, 0, 0}, 1<<14)},
+		{"truncated extension", records(hello([]byte{0, 16, 0, 9, 0}), 1<<14)},
+		{"empty protocol name", records(hello(extension(https.ExtensionALPN, vec16(0)...)), 1<<14)},
+		{"odd supported groups list", records(hello(extension(https.ExtensionSupportedGroups, vec16(0x00)...)), 1<<14)},
+	}
+	for _, tt := range tests {
+		_, err := https.ReadHandshake(bytes.NewReader(tt.raw))
+		assert.Error(t, err, tt.name)
+	}
+}
+
+func TestReadHandshakeBounded(t *testing.T) {
+	// the records of a hello of the maximum size are read without reading
+	// further, the hello of zeros has no valid extensions
+	msg := append([]byte{1, 1, 0, 0}, make([]byte, 1<<16)...)
+	r := io.MultiReader(bytes.NewReader(records(msg, 1<<14)), failReader{})
+	_, err := https.ReadHandshake(r)
+	assert.EqualError(t, err, "could not read extensions")
+}
+
+// failReader fails the test reads
+type failReader struct{}
+
+func (failReader) Read([]byte) (int, error) {
+	return 0, errors.New("unexpected read")
+}
@@ -16,62 +16,91 @@
 
 package https
 
-import (
-	"encoding/binary"
-	"fmt"
-	"io"
-	"io/ioutil"
-)
+import "encoding/binary"
 
-func readUint8(r io.Reader) (uint8, error) {
-	var buf [1]byte
-	if _, err := io.ReadFull(r, buf[:]); err != nil {
-		return 0, err
+// cursor reads the big-endian values and the vectors of a message, the
+// reads fail without consuming anything if the data is too short
+type cursor []byte
+
+func (c *cursor) readUint8(v *uint8) bool {
+	if len(*c) < 1 {
+		return false
+	}
+	*v = (*c)[0]
+	*c = (*c)[1:]
+	return true
+}
+
+func (c *cursor) readUint16(v *uint16) bool {
+	if len(*c) < 2 {
+		return false
 	}
-	return buf[0], nil
+	*v = binary.BigEndian.Uint16(*c)
+	*c = (*c)[2:]
+	return true
 }
 
-// readUint16 interprets data as big-endian.
-func readUint16(r io.Reader) (uint16, error) {
-	var buf [2]byte
-	if _, err := io.ReadFull(r, buf[:]); err != nil {
-		return 0, err
+func (c *cursor) readUint24(v *uint32) bool {
+	if len(*c) < 3 {
+		return false
 	}
-	return binary.BigEndian.Uint16(buf[:]), nil
+	b := *c
+	*v = uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	*c = b[3:]
+	return true
 }
 
-// readUint24 interprets data as big-endian.
-func readUint24(r io.Reader) (uint32, error) {
-	var buf [3]byte
-	if _, err := io.ReadFull(r, buf[:]); err != nil {
-		return 0, err
+func (c *cursor) readBytes(n int, v *[]byte) bool {
+	if len(*c) < n {
+		return false
 	}
-	return uint32(buf[0])<<16 | uint32(buf[1])<<8 | uint32(buf[2]), nil
+	*v = (*c)[:n:n]
+	*c = (*c)[n:]
+	return true
 }
 
-func skip(r io.Reader, sz int64) error {
-	_, err := io.CopyN(ioutil.Discard, r, sz)
-	return err
+func (c *cursor) skip(n int) bool {
+	var b []byte
+	return c.readBytes(n, &b)
 }
 
-func skipVec8(r io.Reader) error {
-	vl, err := readUint8(r)
-	if err != nil {
-		return fmt.Errorf("could not read length: %v", err)
+// readVec8 reads a vector with an 8-bit length
+func (c *cursor) readVec8(v *cursor) bool {
+	var n uint8
+	var b []byte
+	d := *c
+	if !d.readUint8(&n) || !d.readBytes(int(n), &b) {
+		return false
 	}
-	if err := skip(r, int64(vl)); err != nil {
-		return fmt.Errorf("could not skip content: %v", err)
+	*c, *v = d, b
+	return true
+}
+
+// readVec16 reads a vector with a 16-bit length
+func (c *cursor) readVec16(v *cursor) bool {
+	var n uint16
+	var b []byte
+	d := *c
+	if !d.readUint16(&n) || !d.readBytes(int(n), &b) {
+		return false
 	}
-	return nil
+	*c, *v = d, b
+	return true
 }
 
-func skipVec16(r io.Reader) error {
-	vl, err := readUint16(r)
-	if err != nil {
-		return fmt.Errorf("could not read length: %v", err)
+// readUint16s reads the rest of the data as a list of 16-bit values
+func (c *cursor) readUint16s(v *[]uint16) bool {
+	if len(*c)%2 != 0 {
+		return false
 	}
-	if err := skip(r, int64(vl)); err != nil {
-		return fmt.Errorf("could not skip content: %v", err)
+	l := make([]uint16, len(*c)/2)
+	for i := range l {
+		c.readUint16(&l[i])
 	}
-	return nil
+	*v = l
+	return true
+}
+
+func (c *cursor) empty() bool {
+	return len(*c) == 0
 }
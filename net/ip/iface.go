@@ -33,13 +33,10 @@ const (
 	Public
 )
 
-func fromIface(types ...AddressType) (net.IP, bool) {
-	if len(types) == 0 {
-		return nil, false
-	}
+func localAddrs() []net.IP {
 	ifaces, err := net.Interfaces()
 	if err != nil {
-		return nil, false
+		return nil
 	}
 	var ips []net.IP
 	for _, i := range ifaces {
@@ -52,12 +49,25 @@ func fromIface(types ...AddressType) (net.IP, bool) {
 				case *net.IPAddr:
 					ip = v.IP
 				}
-				if ip != nil && !ip.Equal(localhost) {
+				if ip != nil {
 					ips = append(ips, ip)
 				}
 			}
 		}
 	}
+	return ips
+}
+
+func fromIface(types ...AddressType) (net.IP, bool) {
+	if len(types) == 0 {
+		return nil, false
+	}
+	var ips []net.IP
+	for _, ip := range localAddrs() {
+		if !ip.Equal(localhost) {
+			ips = append(ips, ip)
+		}
+	}
 	for _, typ := range types {
 		for _, ip := range ips {
 			switch {
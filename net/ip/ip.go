@@ -36,6 +36,11 @@ func FromIface(types ...AddressType) (net.IP, bool) {
 	return fromIface(types...)
 }
 
+// LocalAddrs returns the addresses of all system network interfaces
+func LocalAddrs() []net.IP {
+	return localAddrs()
+}
+
 // FromEth0 reads public address of the server from eth0.me
 func FromEth0() (net.IP, bool) {
 	return fromExternalService("https://eth0.me")
@@ -57,3 +62,9 @@ func FromIPEcho() (net.IP, bool) {
 func FromExternalService(addr string) (net.IP, bool) {
 	return fromExternalService(addr)
 }
+
+// IsPrivate returns true if the address belongs to a loopback, link-local
+// or private network range
+func IsPrivate(ip net.IP) bool {
+	return isPrivateIP(ip)
+}
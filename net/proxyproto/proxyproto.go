@@ -0,0 +1,230 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Defines the versions of the PROXY protocol
+const (
+	V1 = 1
+	V2 = 2
+)
+
+const (
+	maxV1HeaderSize = 107
+	v2CmdLocal      = 0x00
+	v2CmdProxy      = 0x01
+	v2FamUnspec     = 0x00
+	v2FamTCP4       = 0x11
+	v2FamTCP6       = 0x21
+)
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// Header of a connection that carries the PROXY protocol
+type Header struct {
+	Version int
+	// Source and Destination are nil when the sender does not relay the
+	// address of the original connection, eg. health checks
+	Source      *net.TCPAddr
+	Destination *net.TCPAddr
+}
+
+// ReadHeader reads a version 1 or 2 header, it never reads past the end of
+// the header so that the remaining data can be read from the reader
+func ReadHeader(r io.Reader) (*Header, error) {
+	var sig [12]byte
+	if _, err := io.ReadFull(r, sig[:len(v1Prefix)]); err != nil {
+		return nil, fmt.Errorf("could not read header: %v", err)
+	}
+	if bytes.Equal(sig[:len(v1Prefix)], v1Prefix) {
+		return readV1(r)
+	}
+	if _, err := io.ReadFull(r, sig[len(v1Prefix):]); err != nil {
+		return nil, fmt.Errorf("could not read header: %v", err)
+	}
+	if bytes.Equal(sig[:], v2Signature) {
+		return readV2(r)
+	}
+	return nil, errors.New("missing proxy protocol header")
+}
+
+func readV1(r io.Reader) (*Header, error) {
+	line := make([]byte, 0, maxV1HeaderSize)
+	line = append(line, v1Prefix...)
+
+	var b [1]byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= maxV1HeaderSize {
+			return nil, errors.New("header too long")
+		}
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, fmt.Errorf("could not read header: %v", err)
+		}
+		line = append(line, b[0])
+	}
+
+	parts := strings.Split(string(line[len(v1Prefix):len(line)-2]), " ")
+	switch {
+	case len(parts) > 0 && parts[0] == "UNKNOWN":
+		return &Header{Version: V1}, nil
+	case len(parts) != 5:
+		return nil, fmt.Errorf("malformed header %q", line)
+	case parts[0] != "TCP4" && parts[0] != "TCP6":
+		return nil, fmt.Errorf("unsupported protocol %q", parts[0])
+	}
+
+	src, err := parseV1Addr(parts[1], parts[3])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseV1Addr(parts[2], parts[4])
+	if err != nil {
+		return nil, err
+	}
+	if parts[0] == "TCP4" && (src.IP.To4() == nil || dst.IP.To4() == nil) {
+		return nil, fmt.Errorf("address does not match protocol %q", parts[0])
+	}
+	return &Header{Version: V1, Source: src, Destination: dst}, nil
+}
+
+func parseV1Addr(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+func readV2(r io.Reader) (*Header, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("could not read header: %v", err)
+	}
+	if hdr[0]>>4 != V2 {
+		return nil, fmt.Errorf("unsupported version %d", hdr[0]>>4)
+	}
+	cmd, fam := hdr[0]&0x0f, hdr[1]
+	body := make([]byte, binary.BigEndian.Uint16(hdr[2:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("could not read addresses: %v", err)
+	}
+
+	h := &Header{Version: V2}
+	switch cmd {
+	case v2CmdLocal:
+		return h, nil
+	case v2CmdProxy:
+	default:
+		return nil, fmt.Errorf("unsupported command %d", cmd)
+	}
+
+	// the type-length-value vectors after the addresses are ignored
+	switch fam {
+	case v2FamUnspec:
+		return h, nil
+	case v2FamTCP4:
+		if len(body) < 12 {
+			return nil, errors.New("addresses too short")
+		}
+		h.Source = &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:]))}
+		h.Destination = &net.TCPAddr{IP: net.IP(body[4:8]), Port: int(binary.BigEndian.Uint16(body[10:]))}
+	case v2FamTCP6:
+		if len(body) < 36 {
+			return nil, errors.New("addresses too short")
+		}
+		h.Source = &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:]))}
+		h.Destination = &net.TCPAddr{IP: net.IP(body[16:32]), Port: int(binary.BigEndian.Uint16(body[34:]))}
+	default:
+		return nil, fmt.Errorf("unsupported address family %#x", fam)
+	}
+	return h, nil
+}
+
+// Bytes encodes the header in its version
+func (h *Header) Bytes() []byte {
+	if h.Version == V2 {
+		return h.v2()
+	}
+	return h.v1()
+}
+
+// WriteTo writes the encoded header to w
+func (h *Header) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(h.Bytes())
+	return int64(n), err
+}
+
+func (h *Header) v1() []byte {
+	if h.Source == nil || h.Destination == nil {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+	src, dst := h.Source.IP.String(), h.Destination.IP.String()
+	proto := "TCP4"
+	if h.Source.IP.To4() == nil || h.Destination.IP.To4() == nil {
+		proto, src, dst = "TCP6", formatV6(h.Source.IP), formatV6(h.Destination.IP)
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, src, dst, h.Source.Port, h.Destination.Port))
+}
+
+// formatV6 formats the address in IPv6 notation, IPv4 addresses are mapped
+// into the IPv6 address space
+func formatV6(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return "::ffff:" + v4.String()
+	}
+	return ip.String()
+}
+
+func (h *Header) v2() []byte {
+	b := append([]byte(nil), v2Signature...)
+	if h.Source == nil || h.Destination == nil {
+		return append(b, V2<<4|v2CmdLocal, v2FamUnspec, 0, 0)
+	}
+
+	var body []byte
+	fam := byte(v2FamTCP6)
+	if src, dst := h.Source.IP.To4(), h.Destination.IP.To4(); src != nil && dst != nil {
+		fam = v2FamTCP4
+		body = append(append(body, src...), dst...)
+	} else {
+		body = append(append(body, h.Source.IP.To16()...), h.Destination.IP.To16()...)
+	}
+	body = append(body, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(body[len(body)-4:], uint16(h.Source.Port))
+	binary.BigEndian.PutUint16(body[len(body)-2:], uint16(h.Destination.Port))
+
+	b = append(b, V2<<4|v2CmdProxy, fam, 0, 0)
+	binary.BigEndian.PutUint16(b[len(b)-2:], uint16(len(body)))
+	return append(b, body...)
+}
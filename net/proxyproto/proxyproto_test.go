@@ -0,0 +1,83 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package proxyproto_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/samuelngs/smartdns/net/proxyproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadV1(t *testing.T) {
+	r := bytes.NewBufferString("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\n")
+	h, err := proxyproto.ReadHeader(r)
+	if assert.NoError(t, err) {
+		assert.Equal(t, proxyproto.V1, h.Version)
+		assert.Equal(t, "192.0.2.1:56324", h.Source.String())
+		assert.Equal(t, "198.51.100.1:443", h.Destination.String())
+	}
+	rest, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "GET / HTTP/1.1\r\n", string(rest))
+
+	h, err = proxyproto.ReadHeader(bytes.NewBufferString("PROXY UNKNOWN\r\n"))
+	if assert.NoError(t, err) {
+		assert.Nil(t, h.Source)
+	}
+
+	_, err = proxyproto.ReadHeader(bytes.NewBufferString("PROXY TCP4 2001:db8::1 198.51.100.1 1 2\r\n"))
+	assert.Error(t, err)
+	_, err = proxyproto.ReadHeader(bytes.NewBufferString("POST / HTTP/1.1\r\n"))
+	assert.Error(t, err)
+}
+
+func TestRoundtrip(t *testing.T) {
+	for _, version := range []int{proxyproto.V1, proxyproto.V2} {
+		for _, src := range []string{"192.0.2.1", "2001:db8::1"} {
+			h := &proxyproto.Header{
+				Version:     version,
+				Source:      &net.TCPAddr{IP: net.ParseIP(src), Port: 56324},
+				Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443},
+			}
+			var buf bytes.Buffer
+			h.WriteTo(&buf)
+			buf.WriteString("\x16\x03\x01")
+
+			o, err := proxyproto.ReadHeader(&buf)
+			if assert.NoError(t, err) {
+				assert.Equal(t, version, o.Version)
+				assert.True(t, h.Source.IP.Equal(o.Source.IP))
+				assert.Equal(t, h.Source.Port, o.Source.Port)
+				assert.True(t, h.Destination.IP.Equal(o.Destination.IP))
+				assert.Equal(t, h.Destination.Port, o.Destination.Port)
+			}
+			assert.Equal(t, "\x16\x03\x01", buf.String())
+		}
+	}
+}
+
+func TestLocalV2(t *testing.T) {
+	h := &proxyproto.Header{Version: proxyproto.V2}
+	o, err := proxyproto.ReadHeader(bytes.NewReader(h.Bytes()))
+	if assert.NoError(t, err) {
+		assert.Nil(t, o.Source)
+		assert.Nil(t, o.Destination)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package resolver
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/samuelngs/smartdns/metrics"
+)
+
+const (
+	minCacheTTL      = 5
+	maxCacheTTL      = 3600
+	negativeCacheTTL = 30
+)
+
+var cacheLookups = metrics.NewCounterVec(
+	"smartdns_resolver_cache_lookups_total",
+	"Lookups of the resolver cache by result.",
+	"result")
+
+type cacheKey struct {
+	name        string
+	qtype       uint16
+	nameservers string
+}
+
+type cacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+type cache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[cacheKey]cacheEntry
+}
+
+func newCache(size int) *cache {
+	return &cache{size: size, entries: make(map[cacheKey]cacheEntry)}
+}
+
+func (c *cache) get(key cacheKey) ([]net.IP, bool) {
+	if c.size <= 0 {
+		return nil, false
+	}
+	ips, ok := c.load(key)
+	if ok {
+		cacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		cacheLookups.WithLabelValues("miss").Inc()
+	}
+	return ips, ok
+}
+
+func (c *cache) load(key cacheKey) ([]net.IP, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.ips, true
+}
+
+func (c *cache) set(key cacheKey, ips []net.IP, ttl uint32) {
+	if c.size <= 0 {
+		return
+	}
+	switch {
+	case len(ips) == 0:
+		ttl = negativeCacheTTL
+	case ttl < minCacheTTL:
+		ttl = minCacheTTL
+	case ttl > maxCacheTTL:
+		ttl = maxCacheTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.size {
+		c.evict()
+	}
+	c.entries[key] = cacheEntry{ips: ips, expires: time.Now().Add(time.Duration(ttl) * time.Second)}
+}
+
+// evict removes the expired entries, or an arbitrary one if none has expired
+func (c *cache) evict() {
+	now := time.Now()
+	for key, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) < c.size {
+		return
+	}
+	for key := range c.entries {
+		delete(c.entries, key)
+		return
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/sync/errgroup"
+)
+
+// Preference defines which address family is tried first
+type Preference int8
+
+// Defines the address family preferences
+const (
+	PreferIPv4 Preference = iota
+	PreferIPv6
+)
+
+// Resolver looks up the addresses of domain names through upstream
+// nameservers, bypassing the system resolver
+type Resolver struct {
+	nameservers []string
+	prefer      Preference
+	timeout     time.Duration
+	cache       *cache
+}
+
+// New creates a resolver that queries the nameservers in order, a non-positive
+// cache size disables caching
+func New(nameservers []string, prefer Preference, timeout time.Duration, cacheSize int) *Resolver {
+	addrs := make([]string, len(nameservers))
+	for i, ns := range nameservers {
+		addrs[i] = NameserverAddr(ns)
+	}
+	return &Resolver{
+		nameservers: addrs,
+		prefer:      prefer,
+		timeout:     timeout,
+		cache:       newCache(cacheSize),
+	}
+}
+
+// NameserverAddr appends the default dns port to the nameserver address
+// if it does not have one
+func NameserverAddr(ns string) string {
+	if _, _, err := net.SplitHostPort(ns); err != nil {
+		return net.JoinHostPort(ns, "53")
+	}
+	return ns
+}
+
+// LookupIP looks up the IPv4 and IPv6 addresses of the host through the
+// default nameservers, sorted by the address family preference
+func (r *Resolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	return r.LookupIPWith(ctx, host, r.nameservers...)
+}
+
+// LookupIPWith looks up the addresses of the host through the nameservers
+func (r *Resolver) LookupIPWith(ctx context.Context, host string, nameservers ...string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	if len(nameservers) == 0 {
+		return nil, errors.New("no nameserver is configured")
+	}
+	name := dns.Fqdn(strings.ToLower(host))
+
+	var v4, v6 []net.IP
+	var eg errgroup.Group
+	eg.Go(func() (err error) {
+		v4, err = r.lookup(ctx, name, dns.TypeA, nameservers)
+		return err
+	})
+	eg.Go(func() (err error) {
+		v6, err = r.lookup(ctx, name, dns.TypeAAAA, nameservers)
+		return err
+	})
+	err := eg.Wait()
+
+	var ips []net.IP
+	if r.prefer == PreferIPv6 {
+		ips = append(v6, v4...)
+	} else {
+		ips = append(v4, v6...)
+	}
+	if len(ips) > 0 {
+		return ips, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no address found for %q", host)
+}
+
+func (r *Resolver) lookup(ctx context.Context, name string, qtype uint16, nameservers []string) ([]net.IP, error) {
+	key := cacheKey{name: name, qtype: qtype, nameservers: strings.Join(nameservers, ",")}
+	if ips, ok := r.cache.get(key); ok {
+		return ips, nil
+	}
+
+	var err error
+	for _, ns := range nameservers {
+		var (
+			ips []net.IP
+			ttl uint32
+		)
+		if ips, ttl, err = r.exchange(ctx, name, qtype, NameserverAddr(ns)); err == nil {
+			r.cache.set(key, ips, ttl)
+			return ips, nil
+		}
+	}
+	return nil, err
+}
+
+func (r *Resolver) exchange(ctx context.Context, name string, qtype uint16, ns string) ([]net.IP, uint32, error) {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	c := new(dns.Client)
+	in, _, err := c.ExchangeContext(ctx, m, ns)
+	if err == nil && in.Truncated {
+		c.Net = "tcp"
+		in, _, err = c.ExchangeContext(ctx, m, ns)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	switch in.Rcode {
+	case dns.RcodeSuccess, dns.RcodeNameError:
+	default:
+		return nil, 0, fmt.Errorf("nameserver %s returned %s", ns, dns.RcodeToString[in.Rcode])
+	}
+
+	var (
+		ips []net.IP
+		ttl uint32
+	)
+	for _, rr := range in.Answer {
+		switch o := rr.(type) {
+		case *dns.A:
+			ips = append(ips, o.A)
+		case *dns.AAAA:
+			ips = append(ips, o.AAAA)
+		default:
+			continue
+		}
+		if ttl == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	return ips, ttl, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package resolver_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/samuelngs/smartdns/net/resolver"
+	"github.com/stretchr/testify/assert"
+)
+
+func nameserver(t *testing.T, queries *int32) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(queries, 1)
+		m := new(dns.Msg)
+		m.SetReply(r)
+		q := r.Question[0]
+		switch q.Qtype {
+		case dns.TypeA:
+			rr, _ := dns.NewRR(q.Name + " 60 IN A 192.0.2.1")
+			m.Answer = append(m.Answer, rr)
+		case dns.TypeAAAA:
+			rr, _ := dns.NewRR(q.Name + " 60 IN AAAA 2001:db8::1")
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})}
+	go s.ActivateAndServe()
+	return pc.LocalAddr().String()
+}
+
+func TestLookupIP(t *testing.T) {
+	var queries int32
+	ns := nameserver(t, &queries)
+
+	r := resolver.New([]string{ns}, resolver.PreferIPv4, time.Second, 16)
+	ips, err := r.LookupIP(context.Background(), "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("192.0.2.1").To4(), net.ParseIP("2001:db8::1")}, ips)
+
+	// the answers are served from cache
+	_, err = r.LookupIP(context.Background(), "EXAMPLE.com.")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&queries))
+
+	r = resolver.New([]string{ns}, resolver.PreferIPv6, time.Second, 0)
+	ips, err = r.LookupIP(context.Background(), "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, net.ParseIP("2001:db8::1"), ips[0])
+}
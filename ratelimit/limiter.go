@@ -0,0 +1,83 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the buckets that are full are released
+const sweepInterval = time.Minute
+
+// Limiter keeps a token bucket for every key, eg. a client address
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*Bucket
+	swept   time.Time
+}
+
+// NewLimiter creates a limiter whose buckets refill rate tokens per second
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*Bucket),
+		swept:   time.Now(),
+	}
+}
+
+// Bucket returns the token bucket of the key
+func (l *Limiter) Bucket(key string) *Bucket {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = NewBucket(l.rate, l.burst)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// Allow takes a token from the bucket of the key if one is available
+func (l *Limiter) Allow(key string) bool {
+	return l.Bucket(key).Allow()
+}
+
+// Len returns the number of buckets being tracked
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweep releases the buckets that are full as they are no different from new
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.isFull(now) {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuelngs/smartdns/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucket(t *testing.T) {
+	b := ratelimit.NewBucket(10, 2)
+	now := time.Now()
+	assert.True(t, b.AllowN(now, 1))
+	assert.True(t, b.AllowN(now, 1))
+	assert.False(t, b.AllowN(now, 1))
+	assert.True(t, b.AllowN(now.Add(time.Millisecond*100), 1))
+	assert.False(t, b.AllowN(now.Add(time.Millisecond*100), 1))
+}
+
+func TestBucketTake(t *testing.T) {
+	b := ratelimit.NewBucket(1000, 1000)
+	assert.Equal(t, time.Duration(0), b.Take(1000))
+	wait := b.Take(500)
+	assert.True(t, wait > time.Millisecond*450 && wait <= time.Millisecond*500)
+}
+
+func TestLimiter(t *testing.T) {
+	l := ratelimit.NewLimiter(1, 1)
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+	assert.True(t, l.Allow("b"))
+	assert.Equal(t, 2, l.Len())
+}
@@ -0,0 +1,198 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/log"
+)
+
+// Defines the reasons the sessions are closed for
+const (
+	reasonClosed        = "closed"
+	reasonDenied        = "denied"
+	reasonLimited       = "limited"
+	reasonProxyProtocol = "proxy-protocol-error"
+	reasonHandshake     = "handshake-error"
+	reasonRefused       = "refused"
+	reasonDialError     = "dial-error"
+	reasonTimeout       = "timeout"
+	reasonError         = "error"
+	reasonKilled        = "killed"
+)
+
+// proxyReason returns the close reason of a session that was proxied
+func proxyReason(err error) string {
+	if err == nil {
+		return reasonClosed
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return reasonTimeout
+	}
+	return reasonError
+}
+
+// accessEntry summarizes a session closed by the sni-proxy
+type accessEntry struct {
+	Start      time.Time `json:"start"`
+	Duration   float64   `json:"duration_seconds"`
+	Client     string    `json:"client"`
+	Port       int       `json:"port"`
+	Protocol   string    `json:"protocol"`
+	Hostname   string    `json:"hostname,omitempty"`
+	ALPN       []string  `json:"alpn,omitempty"`
+	TLSVersion string    `json:"tls_version,omitempty"`
+	JA3        string    `json:"ja3,omitempty"`
+	JA4        string    `json:"ja4,omitempty"`
+	ECH        bool      `json:"ech,omitempty"`
+	Upstream   string    `json:"upstream,omitempty"`
+	BytesUp    int64     `json:"bytes_up"`
+	BytesDown  int64     `json:"bytes_down"`
+	Reason     string    `json:"reason"`
+}
+
+func newAccessEntry(s *session) *accessEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := &accessEntry{
+		Start:      s.start,
+		Duration:   time.Since(s.start).Seconds(),
+		Client:     s.clientAddr(),
+		Port:       s.port,
+		Protocol:   s.protocol,
+		Hostname:   s.hostname,
+		ALPN:       s.alpn,
+		TLSVersion: s.tlsVersion,
+		JA3:        s.ja3,
+		JA4:        s.ja4,
+		ECH:        s.ech,
+		BytesUp:    atomic.LoadInt64(&s.bytesUp),
+		BytesDown:  atomic.LoadInt64(&s.bytesDown),
+		Reason:     s.reason,
+	}
+	if s.dst != nil {
+		e.Upstream = s.dst.RemoteAddr().String()
+	}
+	if len(e.Reason) == 0 {
+		e.Reason = reasonClosed
+	}
+	return e
+}
+
+// combined formats the entry like the combined log format, the request is
+// the protocol, the hostname with the port and the application protocols,
+// the status is the close reason and the sizes are the bytes sent to and
+// received from the client
+func (e *accessEntry) combined() string {
+	host := "-"
+	if len(e.Hostname) > 0 {
+		host = fmt.Sprintf("%s:%d", e.Hostname, e.Port)
+	}
+	alpn := "-"
+	if len(e.ALPN) > 0 {
+		alpn = strings.Join(e.ALPN, ",")
+	}
+	protocol := "-"
+	if len(e.Protocol) > 0 {
+		protocol = strings.ToUpper(e.Protocol)
+	}
+	upstream := "-"
+	if len(e.Upstream) > 0 {
+		upstream = e.Upstream
+	}
+	client := e.Client
+	if h, _, err := net.SplitHostPort(client); err == nil {
+		client = h
+	}
+	return fmt.Sprintf(
+		"%s - - [%s] \"%s %s %s\" %s %d %d \"%s\" %.3f\n",
+		client,
+		e.Start.Format("02/Jan/2006:15:04:05 -0700"),
+		protocol, host, alpn,
+		e.Reason,
+		e.BytesDown, e.BytesUp,
+		upstream,
+		e.Duration)
+}
+
+// accessLog writes an entry to the sinks for every session closed
+type accessLog struct {
+	format string
+	sinks  []log.Sink
+}
+
+// newAccessLog opens the sinks of the access log, it returns nil if the
+// access log is disabled or none of the sinks could be opened
+func newAccessLog(conf *config.AccessLog) *accessLog {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+	l := &accessLog{format: conf.Format}
+	for _, s := range conf.Sinks {
+		sink, err := s.Open()
+		if err != nil {
+			logger.Warn(
+				"could not open access log sink",
+				log.String("type", s.Type),
+				log.Error(err))
+			continue
+		}
+		l.sinks = append(l.sinks, sink)
+	}
+	if len(l.sinks) == 0 {
+		return nil
+	}
+	return l
+}
+
+func (l *accessLog) write(s *session) {
+	if l == nil {
+		return
+	}
+	e := newAccessEntry(s)
+	var b []byte
+	if l.format == config.AccessLogCombined {
+		b = []byte(e.combined())
+	} else {
+		var err error
+		if b, err = json.Marshal(e); err != nil {
+			return
+		}
+		b = append(b, '\n')
+	}
+	for _, sink := range l.sinks {
+		if _, err := sink.Write(b); err != nil {
+			logger.Warn("could not write access log", log.Error(err))
+		}
+	}
+}
+
+func (l *accessLog) close() {
+	if l == nil {
+		return
+	}
+	for _, sink := range l.sinks {
+		sink.Close()
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/net/https"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestAccessLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client, src := connPair(t)
+	dst, server := connPair(t)
+	defer client.Close()
+	defer server.Close()
+	defer src.Close()
+	defer dst.Close()
+
+	s := newSession(src, 443)
+	s.start = time.Date(2019, 10, 10, 13, 55, 36, 0, time.UTC)
+	s.setProtocol(protocolTLS)
+	s.setHostname("netflix.com")
+	s.setClientHello(&https.ClientHello{
+		Version:           https.VersionTLS12,
+		ALPN:              []string{"h2", "http/1.1"},
+		SupportedVersions: []uint16{0x0a0a, https.VersionTLS13, https.VersionTLS12},
+	})
+	s.attach(dst)
+	s.bytesUp, s.bytesDown = 512, 4096
+	s.closed(proxyReason(timeoutError{}))
+	s.closed(reasonError)
+
+	conf := config.DefaultAccessLog()
+	conf.Enabled = true
+	conf.Sinks = []*config.Sink{{Type: config.SinkFile, Path: filepath.Join(dir, "access.jsonl")}}
+	l := newAccessLog(conf)
+	conf.Format = config.AccessLogCombined
+	conf.Sinks = []*config.Sink{{Type: config.SinkFile, Path: filepath.Join(dir, "access.log")}}
+	c := newAccessLog(conf)
+	if !assert.NotNil(t, l) || !assert.NotNil(t, c) {
+		return
+	}
+	l.write(s)
+	c.write(s)
+	l.close()
+	c.close()
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "access.jsonl"))
+	assert.NoError(t, err)
+	var e accessEntry
+	assert.NoError(t, json.Unmarshal(b, &e))
+	assert.Equal(t, "netflix.com", e.Hostname)
+	assert.Equal(t, []string{"h2", "http/1.1"}, e.ALPN)
+	assert.Equal(t, "TLS 1.3", e.TLSVersion)
+	assert.Equal(t, "t13i0000h2_000000000000_000000000000", e.JA4)
+	assert.Equal(t, dst.RemoteAddr().String(), e.Upstream)
+	assert.Equal(t, int64(512), e.BytesUp)
+	assert.Equal(t, int64(4096), e.BytesDown)
+	assert.Equal(t, reasonTimeout, e.Reason)
+	assert.Equal(t, 443, e.Port)
+
+	b, err = ioutil.ReadFile(filepath.Join(dir, "access.log"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(b),
+		`127.0.0.1 - - [10/Oct/2019:13:55:36 +0000] "TLS netflix.com:443 h2,http/1.1" timeout 4096 512 "`+dst.RemoteAddr().String()+`" `))
+
+	assert.Nil(t, newAccessLog(config.DefaultAccessLog()))
+}
+
+func TestCloseReason(t *testing.T) {
+	assert.Equal(t, reasonClosed, proxyReason(nil))
+	assert.Equal(t, reasonError, proxyReason(errors.New("connection reset")))
+
+	_, src := connPair(t)
+	s := newSession(src, 80)
+	s.kill()
+	s.closed(reasonDialError)
+	assert.Equal(t, reasonKilled, newAccessEntry(s).Reason)
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/log"
+	"github.com/samuelngs/smartdns/net/egress"
+	"github.com/samuelngs/smartdns/net/ip"
+	"github.com/samuelngs/smartdns/net/resolver"
+)
+
+// refusedError is returned when the destination is not allowed to be proxied
+type refusedError struct {
+	hostname string
+	reason   string
+}
+
+func (e *refusedError) Error() string {
+	return fmt.Sprintf("refused to proxy %q: %s", e.hostname, e.reason)
+}
+
+func isAllowedAddr(addr net.IP) bool {
+	return !addr.IsUnspecified() && !addr.IsMulticast() && !ip.IsPrivate(addr)
+}
+
+// dialer connects to the destinations of proxied connections
+type dialer struct {
+	conf     *config.Config
+	sources  map[string]*egress.SourcePool
+	resolver *resolver.Resolver
+	local    map[string]struct{}
+}
+
+func newDialer(conf *config.Config) *dialer {
+	sources := make(map[string]*egress.SourcePool)
+	for _, src := range conf.SNIProxy.Sources {
+		if src == nil || !src.IsValid() {
+			logger.Warn("ignored invalid source configuration")
+			continue
+		}
+		sources[src.Name] = egress.NewSourcePool(src.Addresses, src.Interface, src.Strategy == config.SourceSticky)
+	}
+
+	prefer := resolver.PreferIPv4
+	if conf.SNIProxy.Resolver.Prefer == config.PreferIPv6 {
+		prefer = resolver.PreferIPv6
+	}
+	r := resolver.New(
+		conf.SNIProxy.Resolver.Nameservers,
+		prefer,
+		conf.SNIProxy.Resolver.Timeout,
+		conf.SNIProxy.Resolver.CacheSize)
+
+	// the addresses this server listens on, connecting to any of them would
+	// loop the connection back to the sni-proxy
+	local := make(map[string]struct{})
+	for _, addr := range ip.LocalAddrs() {
+		local[addr.String()] = struct{}{}
+	}
+	if addr := net.ParseIP(conf.SNIProxy.Host); addr != nil {
+		local[addr.String()] = struct{}{}
+	}
+
+	return &dialer{conf: conf, sources: sources, resolver: r, local: local}
+}
+
+func (d *dialer) isLocalAddr(addr net.IP) bool {
+	_, ok := d.local[addr.String()]
+	return ok
+}
+
+// dial connects to the destination after making sure the hostname is allowed
+// to be proxied and that it does not resolve to a private network address
+func (d *dialer) dial(client net.Addr, hostname string, port int) (*net.TCPConn, error) {
+	if !d.conf.IsAllowedHost(hostname) {
+		return nil, &refusedError{hostname, "hostname is not allowed"}
+	}
+
+	rule := d.conf.Rules().MatchDNS(hostname)
+	egressName, sourceName := d.conf.SNIProxy.DefaultEgress, d.conf.SNIProxy.DefaultSource
+	if rule != nil {
+		if len(rule.Egress) > 0 {
+			egressName = rule.Egress
+		}
+		if len(rule.Source) > 0 {
+			sourceName = rule.Source
+		}
+	}
+	chain, err := d.conf.SNIProxy.EgressChain(egressName)
+	if err != nil {
+		return nil, err
+	}
+	var pool *egress.SourcePool
+	if len(sourceName) > 0 {
+		if pool = d.sources[sourceName]; pool == nil {
+			return nil, fmt.Errorf("source %q is not defined", sourceName)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.conf.SNIProxy.DialTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(hostname, strconv.Itoa(port))
+	if len(chain) == 0 {
+		return d.dialDirect(ctx, pool, rule, addrIP(client), hostname, port)
+	}
+
+	// the hostname is resolved by the last upstream in the chain, only an
+	// address literal can be checked locally
+	if addr := net.ParseIP(hostname); addr != nil {
+		if d.isLocalAddr(addr) {
+			return nil, &refusedError{hostname, "destination loops back to this server"}
+		}
+		if !isAllowedAddr(addr) {
+			return nil, &refusedError{hostname, "destination is a private address"}
+		}
+	}
+	var first net.IP
+	if host, _, err := net.SplitHostPort(chain[0].Address); err == nil {
+		first = net.ParseIP(host)
+	}
+	c, err := newEgressDialer(chain, pool.Dialer(addrIP(client), first)).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return asTCPConn(c)
+}
+
+func (d *dialer) dialDirect(ctx context.Context, pool *egress.SourcePool, rule *config.DNSResolve, client net.IP, hostname string, port int) (*net.TCPConn, error) {
+	addrs, err := d.lookup(ctx, rule, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if d.isLocalAddr(addr) {
+			return nil, &refusedError{hostname, "destination loops back to this server"}
+		}
+		if isAllowedAddr(addr) {
+			allowed = append(allowed, addr)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, &refusedError{hostname, "destination resolves to a private address"}
+	}
+
+	c, err := egress.DialParallel(ctx, allowed, egress.DefaultFallbackDelay, func(ctx context.Context, addr net.IP) (net.Conn, error) {
+		dst := net.JoinHostPort(addr.String(), strconv.Itoa(port))
+		return pool.Dialer(client, addr).DialContext(ctx, "tcp", dst)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asTCPConn(c)
+}
+
+// lookup resolves the hostname with the dns rule that matches it, the proxy
+// rules are resolved through the upstream nameservers
+func (d *dialer) lookup(ctx context.Context, rule *config.DNSResolve, hostname string) ([]net.IP, error) {
+	switch {
+	case rule != nil && len(rule.IP) > 0:
+		if addr := net.ParseIP(rule.IP); addr != nil {
+			return []net.IP{addr}, nil
+		}
+	case rule != nil && len(rule.Nameserver) > 0 && !rule.IsProxy():
+		return d.resolver.LookupIPWith(ctx, hostname, rule.NameserverAddr())
+	}
+	return d.resolver.LookupIP(ctx, hostname)
+}
+
+func newEgressDialer(chain []*config.Egress, d egress.Dialer) egress.Dialer {
+	for _, e := range chain {
+		var auth *egress.Auth
+		if len(e.Username) > 0 || len(e.Password) > 0 {
+			auth = &egress.Auth{Username: e.Username, Password: e.Password}
+		}
+		switch e.Type {
+		case config.EgressSOCKS5:
+			d = egress.SOCKS5(e.Address, auth, d)
+		case config.EgressHTTP:
+			d = egress.HTTPConnect(e.Address, auth, d)
+		}
+	}
+	return d
+}
+
+func asTCPConn(c net.Conn) (*net.TCPConn, error) {
+	if tc, ok := c.(*net.TCPConn); ok {
+		return tc, nil
+	}
+	c.Close()
+	return nil, fmt.Errorf("unsupported connection type %T", c)
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch o := addr.(type) {
+	case *net.TCPAddr:
+		return o.IP
+	case *net.UDPAddr:
+		return o.IP
+	}
+	return nil
+}
+
+// refuse logs and counts the refused connection
+func (h *httpServer) refuse(s *session, err *refusedError) {
+	h.stats.addRefused()
+	s.closed(reasonRefused)
+	refusedTotal.WithLabelValues(err.reason).Inc()
+	s.log.Warn(
+		"refused to proxy connection",
+		log.String("hostname", err.hostname),
+		log.String("reason", err.reason))
+}
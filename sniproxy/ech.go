@@ -0,0 +1,79 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/net/https"
+)
+
+// QueryHistory returns the names a client recently resolved to the proxy
+type QueryHistory interface {
+	// RecentNames returns the names the client resolved since the time,
+	// the latest first
+	RecentNames(client net.IP, since time.Time) []string
+}
+
+// echRouter chooses the destination of the connections whose ClientHello
+// is encrypted, the server name is then the public name of the
+// client-facing server
+type echRouter struct {
+	mu      sync.RWMutex
+	history QueryHistory
+}
+
+func (r *echRouter) setHistory(h QueryHistory) {
+	r.mu.Lock()
+	r.history = h
+	r.mu.Unlock()
+}
+
+// route returns the hostname to forward the connection to, or false if it
+// has to be refused. Browsers send a GREASE ECH extension on ordinary
+// connections, so the policy only applies when the server name is not a
+// host the proxy serves.
+func (r *echRouter) route(conf *config.Config, client net.IP, hello *https.ClientHello) (string, bool) {
+	ech := conf.SNIProxy.ECH
+	if !hello.ECH || ech == nil || conf.IsAllowedHost(hello.ServerName) {
+		return hello.ServerName, true
+	}
+	switch ech.Policy {
+	case config.ECHReject:
+		echTotal.WithLabelValues(config.ECHReject, "refused").Inc()
+		return "", false
+	case config.ECHHistory:
+		r.mu.RLock()
+		h := r.history
+		r.mu.RUnlock()
+		if h != nil {
+			for _, name := range h.RecentNames(client, time.Now().Add(-ech.HistoryWindow)) {
+				if name != hello.ServerName {
+					echTotal.WithLabelValues(config.ECHHistory, "resolved").Inc()
+					return name, true
+				}
+			}
+		}
+		echTotal.WithLabelValues(config.ECHHistory, "refused").Inc()
+		return "", false
+	}
+	echTotal.WithLabelValues(config.ECHForward, "forwarded").Inc()
+	return hello.ServerName, true
+}
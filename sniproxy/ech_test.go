@@ -0,0 +1,77 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/net/https"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeHistory []string
+
+func (h fakeHistory) RecentNames(net.IP, time.Time) []string {
+	return h
+}
+
+func TestECHRoute(t *testing.T) {
+	client := net.ParseIP("10.0.0.1")
+	outer := &https.ClientHello{ServerName: "cloudflare-ech.com", ECH: true}
+	plain := &https.ClientHello{ServerName: "netflix.com"}
+	// browsers send a GREASE ECH extension with the real server name
+	grease := &https.ClientHello{ServerName: "netflix.com", ECH: true}
+	conf := func(policy string) *config.Config {
+		c := config.DefaultConfig()
+		c.DNS.DNSResolveList = config.DNSResolveList{config.ResolveWithProxy("netflix.com", 60)}
+		c.SNIProxy.ECH.Policy = policy
+		return c
+	}
+
+	r := new(echRouter)
+	r.setHistory(fakeHistory{"hulu.com"})
+	for _, policy := range []string{config.ECHForward, config.ECHReject, config.ECHHistory} {
+		for _, hello := range []*https.ClientHello{plain, grease} {
+			name, ok := r.route(conf(policy), client, hello)
+			assert.True(t, ok, policy)
+			assert.Equal(t, "netflix.com", name, policy)
+		}
+	}
+	r.setHistory(nil)
+
+	name, ok := r.route(conf(config.ECHForward), client, outer)
+	assert.True(t, ok)
+	assert.Equal(t, "cloudflare-ech.com", name)
+
+	_, ok = r.route(conf(config.ECHReject), client, outer)
+	assert.False(t, ok)
+
+	_, ok = r.route(conf(config.ECHHistory), client, outer)
+	assert.False(t, ok)
+
+	r.setHistory(fakeHistory{"cloudflare-ech.com", "netflix.com"})
+	name, ok = r.route(conf(config.ECHHistory), client, outer)
+	assert.True(t, ok)
+	assert.Equal(t, "netflix.com", name)
+
+	r.setHistory(fakeHistory{"cloudflare-ech.com"})
+	_, ok = r.route(conf(config.ECHHistory), client, outer)
+	assert.False(t, ok)
+}
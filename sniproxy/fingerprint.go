@@ -0,0 +1,169 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samuelngs/smartdns/net/https"
+)
+
+// ja3 returns the JA3 fingerprint of the ClientHello, the md5 hash of the
+// version, ciphers, extensions, groups and point formats without the GREASE
+// values
+func ja3(hello *https.ClientHello) string {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(int(hello.Version)))
+	b.WriteByte(',')
+	writeJA3List(&b, hello.CipherSuites)
+	b.WriteByte(',')
+	writeJA3List(&b, hello.Extensions)
+	b.WriteByte(',')
+	writeJA3List(&b, hello.SupportedGroups)
+	b.WriteByte(',')
+	for i, f := range hello.PointFormats {
+		if i > 0 {
+			b.WriteByte('-')
+		}
+		b.WriteString(strconv.Itoa(int(f)))
+	}
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeJA3List(b *strings.Builder, values []uint16) {
+	first := true
+	for _, v := range values {
+		if https.IsGREASE(v) {
+			continue
+		}
+		if !first {
+			b.WriteByte('-')
+		}
+		b.WriteString(strconv.Itoa(int(v)))
+		first = false
+	}
+}
+
+// ja4 returns the JA4 fingerprint of the ClientHello received over tcp,
+// which is the protocol, version, sni, counts and alpn of the client
+// followed by the hashes of its sorted ciphers and of its sorted extensions
+// with its signature algorithms
+func ja4(hello *https.ClientHello) string {
+	ciphers := withoutGREASE(hello.CipherSuites)
+	extensions := withoutGREASE(hello.Extensions)
+
+	sni := "i"
+	if hello.HasExtension(https.ExtensionServerName) {
+		sni = "d"
+	}
+	a := fmt.Sprintf("t%s%s%02d%02d%s",
+		ja4Version(hello.TLSVersion()), sni,
+		min99(len(ciphers)), min99(len(extensions)),
+		ja4ALPN(hello.ALPN))
+
+	sort.Slice(ciphers, func(i, j int) bool { return ciphers[i] < ciphers[j] })
+	b := ja4Hash(hexList(ciphers))
+
+	var sorted []uint16
+	for _, e := range extensions {
+		if e != https.ExtensionServerName && e != https.ExtensionALPN {
+			sorted = append(sorted, e)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	c := hexList(sorted)
+	if algs := hexList(withoutGREASE(hello.SignatureAlgorithms)); len(c) > 0 && len(algs) > 0 {
+		c += "_" + algs
+	}
+	return a + "_" + b + "_" + ja4Hash(c)
+}
+
+func ja4Version(v uint16) string {
+	switch v {
+	case https.VersionTLS13:
+		return "13"
+	case https.VersionTLS12:
+		return "12"
+	case https.VersionTLS11:
+		return "11"
+	case https.VersionTLS10:
+		return "10"
+	case https.VersionSSL30:
+		return "s3"
+	}
+	return "00"
+}
+
+// ja4ALPN returns the first and the last characters of the first protocol,
+// or of its hex form if they are not alphanumeric
+func ja4ALPN(alpn []string) string {
+	if len(alpn) == 0 || len(alpn[0]) == 0 {
+		return "00"
+	}
+	p := alpn[0]
+	if first, last := p[0], p[len(p)-1]; isAlnum(first) && isAlnum(last) {
+		return string([]byte{first, last})
+	}
+	h := hex.EncodeToString([]byte(p))
+	return string([]byte{h[0], h[len(h)-1]})
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// ja4Hash returns the first 12 characters of the sha256 hash of the list,
+// or zeros if the list is empty
+func ja4Hash(s string) string {
+	if len(s) == 0 {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func hexList(values []uint16) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(s, ",")
+}
+
+func withoutGREASE(values []uint16) []uint16 {
+	o := make([]uint16, 0, len(values))
+	for _, v := range values {
+		if !https.IsGREASE(v) {
+			o = append(o, v)
+		}
+	}
+	return o
+}
+
+func min99(n int) int {
+	if n > 99 {
+		return 99
+	}
+	return n
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"testing"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/net/https"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJA3(t *testing.T) {
+	hello := &https.ClientHello{
+		Version:         https.VersionTLS10,
+		CipherSuites:    []uint16{0x2a2a, 47, 53, 5, 10, 49161, 49162, 49171, 49172, 50, 56, 19, 4},
+		Extensions:      []uint16{0, 10, 11},
+		SupportedGroups: []uint16{23, 24, 25},
+		PointFormats:    []uint8{0},
+	}
+	assert.Equal(t, "ada70206e40642a3e4461f35503241d5", ja3(hello))
+}
+
+func TestJA4(t *testing.T) {
+	hello := &https.ClientHello{
+		Version: https.VersionTLS12,
+		CipherSuites: []uint16{
+			0x3a3a, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030,
+			0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035},
+		Extensions: []uint16{
+			0x8a8a, 0x0000, 0x0017, 0xff01, 0x000a, 0x000b, 0x0023, 0x0010,
+			0x0005, 0x000d, 0x0012, 0x0033, 0x002d, 0x002b, 0x001b, 0x4469,
+			0x0015, 0xbaba},
+		ALPN:              []string{"h2", "http/1.1"},
+		SupportedVersions: []uint16{0x4a4a, https.VersionTLS13, https.VersionTLS12},
+		SignatureAlgorithms: []uint16{
+			0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601},
+	}
+	assert.Equal(t, "t13d1516h2_8daaf6152771_e5627efa2ab1", ja4(hello))
+
+	hello = &https.ClientHello{
+		Version:      https.VersionTLS12,
+		CipherSuites: []uint16{0x002f},
+		ALPN:         []string{"\x00x"},
+	}
+	assert.Equal(t, "t12i010008_ba72b8082249_000000000000", ja4(hello))
+}
+
+func TestAllowFingerprint(t *testing.T) {
+	conf := config.DefaultConfig()
+	conf.SNIProxy.Fingerprints.Denied = []string{"t12i*"}
+	h := &httpServer{conf: conf}
+
+	client, src := connPair(t)
+	defer client.Close()
+	defer src.Close()
+	s := newSession(src, 443)
+	s.setClientHello(&https.ClientHello{Version: https.VersionTLS12, CipherSuites: []uint16{0x002f}})
+	assert.True(t, h.allowFingerprint(s))
+
+	conf.SNIProxy.Fingerprints.Denied = []string{"t12i010000_*_*"}
+	assert.False(t, h.allowFingerprint(s))
+}
@@ -20,78 +20,97 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 )
 
-type reader struct {
-	io.Reader
-	ResetTimeout func()
-	Close        func() error
-	RemoteAddr   func() net.Addr
-}
-
-type writer struct {
-	io.Writer
-	ResetTimeout func()
-	Close        func() error
-	RemoteAddr   func() net.Addr
-}
-
-func newReader(c *net.TCPConn, timeout time.Duration, prefix ...io.Reader) reader {
-	var rd io.Reader
-	if len(prefix) > 0 && prefix[0] != nil {
-		rd = io.MultiReader(prefix[0], c)
-	} else {
-		rd = c
-	}
-	return reader{
-		Reader:       rd,
-		ResetTimeout: func() { c.SetReadDeadline(time.Now().Add(timeout)) },
-		Close:        c.CloseRead,
-		RemoteAddr:   c.RemoteAddr,
-	}
-}
+// chunkSize limits the bytes moved by a single copy
+const chunkSize = 1 << 18
 
-func newWriter(c *net.TCPConn, timeout time.Duration) writer {
-	return writer{
-		Writer:       c,
-		ResetTimeout: func() { c.SetWriteDeadline(time.Now().Add(timeout)) },
-		Close:        c.CloseWrite,
-		RemoteAddr:   c.RemoteAddr,
-	}
-}
+// proxy forwards data between the client and the destination, up and down
+// account and shape the data sent by the client and the destination. The
+// session is idle once neither side has sent data for the timeout, a client
+// that stays silent during a download is not idle. Both connections are
+// closed once a direction fails so that the other one does not wait for a
+// peer that is gone.
+func proxy(src, dst *net.TCPConn, timeout time.Duration, prefix io.Reader, up, down *flow) error {
+	defer src.Close()
+	defer dst.Close()
 
-func proxy(src, dst *net.TCPConn, timeout time.Duration, prefix io.Reader) error {
+	last := time.Now().UnixNano()
 	var eg errgroup.Group
-	eg.Go(func() error { return forward(newWriter(dst, timeout), newReader(src, timeout, prefix)) })
-	eg.Go(func() error { return forward(newWriter(src, timeout), newReader(dst, timeout)) })
+	run := func(fn func() error) {
+		eg.Go(func() error {
+			err := fn()
+			if err != nil {
+				src.Close()
+				dst.Close()
+			}
+			return err
+		})
+	}
+	run(func() error { return forward(dst, src, timeout, &last, prefix, up) })
+	run(func() error { return forward(src, dst, timeout, &last, nil, down) })
 	return eg.Wait()
 }
 
-func forward(dst writer, src reader) error {
-	defer src.Close()
-	defer dst.Close()
+// forward copies data from src to dst until src reaches EOF or the session
+// has been idle for the timeout. last holds the unix nanoseconds of the latest
+// data forwarded in either direction, a direction on its own passes nil. The
+// data is moved with TCPConn.ReadFrom so that it never leaves the kernel on
+// linux. Instead of extending the read deadline on every read, the deadline
+// expires every half timeout and is moved forward while the session is
+// active. The write deadline trails the read deadline by the timeout, a
+// destination that stops reading fails the connection; the data of the
+// interrupted splice is lost along with it.
+func forward(dst, src *net.TCPConn, timeout time.Duration, last *int64, prefix io.Reader, f *flow) error {
+	defer src.CloseRead()
+	defer dst.CloseWrite()
 
-	var buf [4096]byte
-	defer src.ResetTimeout()
-	defer dst.ResetTimeout()
+	if last == nil {
+		last = new(int64)
+		*last = time.Now().UnixNano()
+	}
+	if prefix != nil {
+		dst.SetWriteDeadline(time.Now().Add(timeout))
+		n, err := io.Copy(dst, prefix)
+		if err != nil {
+			return fmt.Errorf("could not write to %q: %v", dst.RemoteAddr(), err)
+		}
+		f.add(n)
+		atomic.StoreInt64(last, time.Now().UnixNano())
+	}
 
+	deadline := time.Now().Add(timeout / 2)
+	src.SetReadDeadline(deadline)
 	for {
-		n, err := src.Read(buf[:])
+		writeDeadline := deadline.Add(timeout)
+		dst.SetWriteDeadline(writeDeadline)
+		lr := &io.LimitedReader{R: src, N: f.chunk()}
+		n, err := dst.ReadFrom(lr)
 		if n > 0 {
-			src.ResetTimeout()
-			if _, err := dst.Write(buf[:n]); err != nil {
-				return fmt.Errorf("could not write to %q: %v", dst.RemoteAddr(), err)
+			if wait := f.add(n); wait > 0 {
+				time.Sleep(wait)
 			}
-			dst.ResetTimeout()
+			atomic.StoreInt64(last, time.Now().UnixNano())
 		}
 		switch {
-		case err == io.EOF:
+		case err == nil && lr.N == 0:
+			continue
+		case err == nil:
 			return nil
-		case err != nil:
-			return fmt.Errorf("error reading from %q: %v", src.RemoteAddr(), err)
+		case isTimeout(err) && time.Since(time.Unix(0, atomic.LoadInt64(last))) < timeout && time.Now().Before(writeDeadline):
+			deadline = time.Now().Add(timeout / 2)
+			src.SetReadDeadline(deadline)
+			continue
 		}
+		return fmt.Errorf("could not forward from %q to %q: %v", src.RemoteAddr(), dst.RemoteAddr(), err)
 	}
 }
+
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
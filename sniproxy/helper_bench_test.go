@@ -0,0 +1,107 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build linux
+// +build linux
+
+package sniproxy
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// bufferedForward is the previous implementation of forward, which copies
+// through a user space buffer and extends the deadlines on every read
+func bufferedForward(dst, src *net.TCPConn, timeout time.Duration) error {
+	defer src.CloseRead()
+	defer dst.CloseWrite()
+
+	var buf [4096]byte
+	for {
+		n, err := src.Read(buf[:])
+		if n > 0 {
+			src.SetReadDeadline(time.Now().Add(timeout))
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+			dst.SetWriteDeadline(time.Now().Add(timeout))
+		}
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
+
+func cpuTime() time.Duration {
+	var ru syscall.Rusage
+	syscall.Getrusage(syscall.RUSAGE_SELF, &ru)
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+func benchmarkForward(b *testing.B, fwd func(dst, src *net.TCPConn) error) {
+	const size = 1 << 20
+
+	client, src := connPair(b)
+	dst, server := connPair(b)
+	defer client.Close()
+	defer server.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- fwd(dst, src) }()
+	go io.Copy(ioutil.Discard, server)
+
+	data := make([]byte, size)
+	b.SetBytes(size)
+	b.ResetTimer()
+	cpu := cpuTime()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Write(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+	client.CloseWrite()
+	if err := <-done; err != nil {
+		b.Fatal(err)
+	}
+
+	b.StopTimer()
+	gigabits := float64(b.N) * size * 8 / 1e9
+	b.ReportMetric(float64(cpuTime()-cpu)/float64(time.Millisecond)/gigabits, "cpu-ms/Gb")
+}
+
+// BenchmarkForward compares the throughput and the cpu time spent per gigabit
+// of the buffered copy and the splice based forwarding over loopback
+func BenchmarkForward(b *testing.B) {
+	b.Run("buffered", func(b *testing.B) {
+		benchmarkForward(b, func(dst, src *net.TCPConn) error {
+			return bufferedForward(dst, src, time.Minute)
+		})
+	})
+	b.Run("splice", func(b *testing.B) {
+		benchmarkForward(b, func(dst, src *net.TCPConn) error {
+			return forward(dst, src, time.Minute, nil, nil, nil)
+		})
+	})
+}
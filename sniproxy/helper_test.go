@@ -0,0 +1,163 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// connPair returns both ends of a loopback tcp connection
+func connPair(t testing.TB) (*net.TCPConn, *net.TCPConn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.(*net.TCPConn), (<-accepted).(*net.TCPConn)
+}
+
+func TestProxy(t *testing.T) {
+	client, src := connPair(t)
+	dst, server := connPair(t)
+
+	done := make(chan error, 1)
+	go func() { done <- proxy(src, dst, time.Second, bytes.NewBufferString("hello "), nil, nil) }()
+
+	client.Write([]byte("world"))
+	client.CloseWrite()
+	b, err := ioutil.ReadAll(server)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(b))
+
+	server.Write([]byte("bye"))
+	server.CloseWrite()
+	b, err = ioutil.ReadAll(client)
+	assert.NoError(t, err)
+	assert.Equal(t, "bye", string(b))
+
+	assert.NoError(t, <-done)
+}
+
+func TestProxyIdleTimeout(t *testing.T) {
+	client, src := connPair(t)
+	dst, server := connPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- forward(dst, src, time.Millisecond*200, nil, nil, nil) }()
+
+	// the connection is kept open while data trickles in below the chunk size
+	go io.Copy(ioutil.Discard, server)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		client.Write([]byte("ping"))
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	assert.Error(t, <-done)
+	assert.True(t, time.Since(start) >= time.Millisecond*600)
+}
+
+func TestProxySilentClient(t *testing.T) {
+	client, src := connPair(t)
+	dst, server := connPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- proxy(src, dst, time.Millisecond*200, nil, nil, nil) }()
+
+	// the client only reads while the server streams for longer than the
+	// timeout, the session stays open until the server is done
+	go func() {
+		for i := 0; i < 10; i++ {
+			server.Write([]byte("data"))
+			time.Sleep(time.Millisecond * 50)
+		}
+		server.CloseWrite()
+	}()
+	b, err := ioutil.ReadAll(client)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("data", 10), string(b))
+
+	// the session is idle once the download is over
+	assert.Error(t, <-done)
+}
+
+func TestProxyStalledPeer(t *testing.T) {
+	client, src := connPair(t)
+	dst, server := connPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- proxy(src, dst, time.Millisecond*200, nil, nil, nil) }()
+
+	// the server keeps the connection active but never reads what the
+	// client sends
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond * 50):
+				server.Write([]byte("ping"))
+			}
+		}
+	}()
+	go func() {
+		b := make([]byte, 1<<16)
+		for {
+			if _, err := client.Write(b); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(time.Second * 10):
+		t.Fatal("proxy is blocked on a peer that does not read")
+	}
+
+	// both connections are closed
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := io.Copy(ioutil.Discard, client)
+	assert.False(t, isTimeout(err))
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"sort"
+	"sync"
+)
+
+// maxTrackedHosts bounds the number of hostnames counted, the hostnames seen
+// after the limit is reached are not counted
+const maxTrackedHosts = 4096
+
+// HostStats contains the traffic proxied to a hostname
+type HostStats struct {
+	Hostname    string `json:"hostname"`
+	Connections int64  `json:"connections"`
+	BytesUp     int64  `json:"bytes_up"`
+	BytesDown   int64  `json:"bytes_down"`
+}
+
+// hosts counts the connections and the traffic by destination hostname
+type hosts struct {
+	mu sync.Mutex
+	m  map[string]*HostStats
+}
+
+func newHosts() *hosts {
+	return &hosts{m: make(map[string]*HostStats)}
+}
+
+func (h *hosts) add(hostname string, conns, up, down int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	o, ok := h.m[hostname]
+	if !ok {
+		if len(h.m) >= maxTrackedHosts {
+			return
+		}
+		o = &HostStats{Hostname: hostname}
+		h.m[hostname] = o
+	}
+	o.Connections += conns
+	o.BytesUp += up
+	o.BytesDown += down
+}
+
+// top returns at most n hostnames with the most connections
+func (h *hosts) top(n int) []HostStats {
+	h.mu.Lock()
+	o := make([]HostStats, 0, len(h.m))
+	for _, s := range h.m {
+		o = append(o, *s)
+	}
+	h.mu.Unlock()
+
+	sort.Slice(o, func(i, j int) bool {
+		if o[i].Connections != o[j].Connections {
+			return o[i].Connections > o[j].Connections
+		}
+		return o[i].Hostname < o[j].Hostname
+	})
+	if n > 0 && n < len(o) {
+		o = o[:n]
+	}
+	return o
+}
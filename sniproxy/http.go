@@ -17,19 +17,34 @@
 package sniproxy
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/samuelngs/smartdns/config"
 	"github.com/samuelngs/smartdns/log"
 	"github.com/samuelngs/smartdns/net/http"
 	"github.com/samuelngs/smartdns/net/https"
+	"github.com/samuelngs/smartdns/net/proxyproto"
+	"github.com/samuelngs/smartdns/ratelimit"
 )
 
 type httpServer struct {
 	conf     *config.Config
+	stats    *stats
+	dialer   *dialer
+	limiter  *limiter
+	rejects  *throttle
+	meter    *meter
+	sessions *sessions
+	hosts    *hosts
+	access   *accessLog
+	ech      *echRouter
 	port     int
 	listener net.Listener
 	started  bool
@@ -40,7 +55,7 @@ func (h *httpServer) listen() error {
 	if err != nil {
 		logger.Warn(
 			"could not listen for HTTP and HTTPS connections",
-			log.String("error", err.Error()))
+			log.Error(err))
 		return err
 	}
 	h.started = false
@@ -58,126 +73,303 @@ func (h *httpServer) shutdown() {
 }
 
 func (h *httpServer) acceptConnection(l net.Listener) {
-	logger.Debug("accepting HTTP and HTTPS connections", log.String("addr", l.Addr().String()))
+	logger.Debug("accepting HTTP and HTTPS connections", log.Addr("addr", l.Addr()))
 	for {
 		c, err := l.Accept()
 		if err != nil {
 			logger.Warn(
 				"could not accept HTTP or HTTPS connection",
-				log.String("error", err.Error()))
+				log.Error(err))
 			if h.started {
 				continue
 			}
 			return
 		}
+		if l, ok := h.limiter.accept(); !ok {
+			h.reject(c.RemoteAddr(), l)
+			c.Close()
+			continue
+		}
 		go h.handleConnection(c.(*net.TCPConn))
 	}
 }
 
 func (h *httpServer) handleConnection(c *net.TCPConn) {
+	s := newSession(c, h.port)
+	defer h.limiter.release()
+	defer h.handshakeDone(s)
 	defer c.Close()
-	defer logger.Trace(
-		"connection closed",
-		log.String("remote-addr", c.RemoteAddr().String()))
-
-	if !h.conf.Network.IsAllowedIP(c.RemoteAddr()) {
-		logger.Trace(
-			"connection rejected",
-			log.String("remote-addr", c.RemoteAddr().String()))
+	defer func() {
+		if len(s.protocol) > 0 {
+			sessionDuration.WithLabelValues(s.protocol).Observe(time.Since(s.start).Seconds())
+		}
+		h.access.write(s)
+		s.log.Trace("connection closed")
+	}()
+
+	c.SetDeadline(time.Now().Add(h.conf.SNIProxy.ConnTimeout))
+
+	if h.conf.SNIProxy.ProxyProtocol.IsTrusted(addrIP(c.RemoteAddr())) {
+		hdr, err := proxyproto.ReadHeader(c)
+		if err != nil {
+			s.closed(reasonProxyProtocol)
+			s.log.Warn(
+				"could not read proxy protocol header",
+				log.Error(err))
+			return
+		}
+		if hdr.Source != nil {
+			s.setClient(hdr.Source)
+			s.target = hdr.Destination
+		}
+	}
+
+	if !h.conf.IsAllowedIP(s.client) {
+		s.closed(reasonDenied)
+		s.log.Trace("connection rejected")
+		return
+	}
+
+	client := addrIP(s.client)
+	if l, ok := h.limiter.acquireClient(client); !ok {
+		s.closed(reasonLimited)
+		h.reject(s.client, l)
 		return
 	}
+	defer h.limiter.releaseClient(client)
+	s.account = h.meter.account(client)
+	defer h.meter.release(s.account)
 
-	logger.Trace(
-		"connection accepted",
-		log.String("remote-addr", c.RemoteAddr().String()))
+	h.sessions.add(s)
+	defer h.sessions.remove(s)
 
-	c.SetDeadline(time.Now().Add(h.conf.SNIProxy.ConnTimeout))
+	s.log.Trace("connection accepted")
 
-	logger.Trace(
-		"checking connection protocol",
-		log.String("remote-addr", c.RemoteAddr().String()))
+	s.log.Trace("checking connection protocol")
 
 	f := make([]byte, 1)
 	c.Read(f)
 
 	if f[0] == 22 {
-		h.handleHTTPSConnection(c)
+		s.setProtocol(protocolTLS)
+	} else {
+		s.setProtocol(protocolHTTP)
+	}
+	connectionsTotal.WithLabelValues(strconv.Itoa(h.port), s.protocol).Inc()
+
+	if s.protocol == protocolTLS {
+		h.handleHTTPSConnection(s)
 		return
 	}
 
 	hostname, prefix, err := http.ParseHost(c, f)
 	if err != nil {
-		logger.Warn(err.Error(), log.String("remote-addr", c.RemoteAddr().String()))
+		handshakeErrors.WithLabelValues(protocolHTTP).Inc()
+		s.closed(reasonHandshake)
+		s.log.Warn("could not parse http request", log.Error(err))
 		return
 	}
 
-	h.handleHTTPConnection(c, hostname, prefix)
+	h.handshakeDone(s)
+	h.handleHTTPConnection(s, hostname, prefix)
 }
 
-func (h *httpServer) handleHTTPConnection(c *net.TCPConn, hostname string, prefix io.Reader) {
-	logger.Trace("proxying http connection",
-		log.String("remote-addr", c.RemoteAddr().String()),
-		log.String("hostname", hostname))
+func (h *httpServer) handshakeDone(s *session) {
+	if s.pending {
+		s.pending = false
+		h.limiter.handshakeDone()
+	}
+}
+
+// reject counts and logs the connection rejected by a connection limit, the
+// logs are throttled since rejections come in bursts
+func (h *httpServer) reject(addr net.Addr, l limit) {
+	h.stats.addLimited(l)
+	limitedTotal.WithLabelValues(l.String()).Inc()
+	h.rejects.warn(
+		"connection rejected by limit",
+		log.Addr("remote-addr", addr),
+		log.Stringer("limit", l))
+}
+
+func (h *httpServer) handleHTTPConnection(s *session, hostname string, prefix io.Reader) {
+	if host, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = host
+	}
+
+	if s.log.Enabled(log.LogTrace) {
+		s.log.Trace(
+			"proxying http connection",
+			log.String("hostname", hostname))
+	}
 
-	uri := net.JoinHostPort(hostname, fmt.Sprintf("%d", h.port))
-	dst, err := net.DialTimeout("tcp", uri, h.conf.SNIProxy.DialTimeout)
+	dst, err := h.connect(s, hostname)
+	if e, ok := err.(*refusedError); ok {
+		h.refuse(s, e)
+		return
+	}
 	if err != nil {
-		logger.Warn(
+		s.closed(reasonDialError)
+		s.log.Warn(
 			"could not forward http request",
-			log.String("error", err.Error()),
-			log.String("remote-addr", c.RemoteAddr().String()))
+			log.Error(err))
 		return
 	}
+	defer dst.Close()
 
-	if err := proxy(c, dst.(*net.TCPConn), h.conf.SNIProxy.DataTimeout, prefix); err != nil {
-		logger.Warn(
+	err = h.proxy(s, dst, prefix)
+	s.closed(proxyReason(err))
+	if err != nil {
+		s.log.Warn(
 			"could not proxy http connection",
-			log.String("error", err.Error()),
-			log.String("remote-addr", c.RemoteAddr().String()),
+			log.Error(err),
 			log.String("hostname", hostname))
 		return
 	}
 }
 
-func (h *httpServer) handleHTTPSConnection(c *net.TCPConn) {
-	logger.Trace("reading sni-hostname",
-		log.String("remote-addr", c.RemoteAddr().String()))
+func (h *httpServer) handleHTTPSConnection(s *session) {
+	s.log.Trace("reading sni-hostname")
 
-	m, err := https.ParseHandshakeMessage(c)
+	m, err := https.ParseHandshakeMessage(s.conn)
 	if err != nil {
-		logger.Warn(
+		handshakeErrors.WithLabelValues(protocolTLS).Inc()
+		s.closed(reasonHandshake)
+		s.log.Warn(
 			"could not read sni-hostname",
-			log.String("remote-addr", c.RemoteAddr().String()),
-			log.String("error", err.Error()))
+			log.Error(err))
 		return
 	}
 	if len(m.Hostname) == 0 {
-		logger.Warn(
-			"could not read sni-hostname",
-			log.String("remote-addr", c.RemoteAddr().String()))
+		handshakeErrors.WithLabelValues(protocolTLS).Inc()
+		s.closed(reasonHandshake)
+		s.log.Warn("could not read sni-hostname")
 		return
 	}
 
-	logger.Trace("proxying https connection",
-		log.String("remote-addr", c.RemoteAddr().String()),
-		log.String("hostname", m.Hostname))
+	h.handshakeDone(s)
+	s.setClientHello(m.ClientHello)
+	if !h.allowFingerprint(s) {
+		h.refuse(s, &refusedError{m.Hostname, "tls fingerprint is not allowed"})
+		return
+	}
+	hostname, ok := h.ech.route(h.conf, addrIP(s.client), m.ClientHello)
+	if !ok {
+		h.refuse(s, &refusedError{m.Hostname, "client hello is encrypted"})
+		return
+	}
 
-	uri := net.JoinHostPort(m.Hostname, fmt.Sprintf("%d", h.port))
-	dst, err := net.DialTimeout("tcp", uri, h.conf.SNIProxy.DialTimeout)
+	if s.log.Enabled(log.LogTrace) {
+		s.log.Trace(
+			"proxying https connection",
+			log.String("hostname", hostname),
+			log.String("tls-version", https.VersionName(m.ClientHello.TLSVersion())),
+			log.String("alpn", strings.Join(m.ALPN, ",")),
+			log.String("ja4", s.ja4),
+			log.Bool("ech", m.ClientHello.ECH))
+	}
+
+	dst, err := h.connect(s, hostname)
+	if e, ok := err.(*refusedError); ok {
+		h.refuse(s, e)
+		return
+	}
 	if err != nil {
-		logger.Warn(
+		s.closed(reasonDialError)
+		s.log.Warn(
 			"could not forward https request",
-			log.String("error", err.Error()),
-			log.String("remote-addr", c.RemoteAddr().String()))
+			log.Error(err))
 		return
 	}
+	defer dst.Close()
 
-	if err := proxy(c, dst.(*net.TCPConn), h.conf.SNIProxy.DataTimeout, &m.Buffer); err != nil {
-		logger.Warn(
+	err = h.proxy(s, dst, &m.Buffer)
+	s.closed(proxyReason(err))
+	if err != nil {
+		s.log.Warn(
 			"could not proxy https connection",
-			log.String("error", err.Error()),
-			log.String("remote-addr", c.RemoteAddr().String()),
-			log.String("hostname", m.Hostname))
+			log.Error(err),
+			log.String("hostname", hostname))
 		return
 	}
 }
+
+// allowFingerprint checks the fingerprints of the client against the
+// configured ones
+func (h *httpServer) allowFingerprint(s *session) bool {
+	conf := h.conf.SNIProxy.Fingerprints
+	if conf == nil {
+		return true
+	}
+	allowed, entry := conf.Match(s.fingerprints())
+	if len(entry) > 0 {
+		action := "allow"
+		if !allowed {
+			action = "deny"
+		}
+		fingerprintMatches.WithLabelValues(entry, action).Inc()
+	}
+	return allowed
+}
+
+// connect dials the destination and sends the PROXY protocol header that
+// relays the client address when it is enabled
+func (h *httpServer) connect(s *session, hostname string) (*net.TCPConn, error) {
+	if h.conf.SNIProxy.Traffic.OnExhausted == config.QuotaRefuse && s.account.exhausted() {
+		return nil, &refusedError{hostname, "traffic quota is exhausted"}
+	}
+
+	s.setHostname(hostname)
+	dst, err := h.dialer.dial(s.client, hostname, h.port)
+	if err != nil {
+		if _, ok := err.(*refusedError); !ok {
+			dialErrors.WithLabelValues().Inc()
+		}
+		return nil, err
+	}
+	if !s.attach(dst) {
+		dst.Close()
+		return nil, errors.New("session was killed")
+	}
+	h.hosts.add(hostname, 1, 0, 0)
+
+	var version int
+	switch h.conf.SNIProxy.ProxyProtocol.Send {
+	case config.ProxyProtocolV1:
+		version = proxyproto.V1
+	case config.ProxyProtocolV2:
+		version = proxyproto.V2
+	default:
+		return dst, nil
+	}
+	src, _ := s.client.(*net.TCPAddr)
+	tgt, _ := s.target.(*net.TCPAddr)
+	hdr := &proxyproto.Header{Version: version, Source: src, Destination: tgt}
+	if _, err := hdr.WriteTo(dst); err != nil {
+		dst.Close()
+		return nil, fmt.Errorf("could not send proxy protocol header: %v", err)
+	}
+	return dst, nil
+}
+
+// proxy forwards the session to the destination, applying the rate limits of
+// the connection and the account of the client
+func (h *httpServer) proxy(s *session, dst *net.TCPConn, prefix io.Reader) error {
+	var buckets []*ratelimit.Bucket
+	if rate := h.conf.SNIProxy.Traffic.ConnRate; rate > 0 {
+		buckets = append(buckets, newRateBucket(rate))
+	}
+	if bucket := s.account.rate(); bucket != nil {
+		buckets = append(buckets, bucket)
+	}
+	up := &flow{bytes: &s.bytesUp, total: bytesTotal.WithLabelValues("up"), account: s.account, buckets: buckets}
+	down := &flow{bytes: &s.bytesDown, total: bytesTotal.WithLabelValues("down"), account: s.account, buckets: buckets}
+
+	active := activeSessions.WithLabelValues()
+	active.Inc()
+	defer active.Dec()
+	defer func() {
+		h.hosts.add(s.hostname, 0, atomic.LoadInt64(&s.bytesUp), atomic.LoadInt64(&s.bytesDown))
+	}()
+	return proxy(s.conn, dst, h.conf.SNIProxy.DataTimeout, prefix, up, down)
+}
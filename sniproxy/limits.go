@@ -0,0 +1,154 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/log"
+	"github.com/samuelngs/smartdns/ratelimit"
+)
+
+// limit identifies the limit that rejected a connection
+type limit int
+
+// Defines the connection limits
+const (
+	limitConns limit = iota
+	limitPendingHandshakes
+	limitClientConns
+	limitClientRate
+	numLimits
+)
+
+var limitRefs = [numLimits]string{
+	limitConns:             "max-conns",
+	limitPendingHandshakes: "max-pending-handshakes",
+	limitClientConns:       "max-conns-per-client",
+	limitClientRate:        "conn-rate-per-client",
+}
+
+func (l limit) String() string {
+	return limitRefs[l]
+}
+
+// limiter enforces the connection limits shared by all listeners
+type limiter struct {
+	conf    *config.Limits
+	conns   int64
+	pending int64
+	mu      sync.Mutex
+	clients map[string]int
+	rate    *ratelimit.Limiter
+}
+
+func newLimiter(conf *config.Limits) *limiter {
+	l := &limiter{conf: conf, clients: make(map[string]int)}
+	if conf.ConnRatePerClient > 0 {
+		burst := conf.ConnBurstPerClient
+		if burst <= 0 {
+			burst = int(conf.ConnRatePerClient) + 1
+		}
+		l.rate = ratelimit.NewLimiter(conf.ConnRatePerClient, burst)
+	}
+	return l
+}
+
+// accept reserves a connection and a pending handshake before the connection
+// is handled, it runs on the accept loop so it does not know the client yet
+func (l *limiter) accept() (limit, bool) {
+	if n := atomic.AddInt64(&l.conns, 1); l.conf.MaxConns > 0 && n > int64(l.conf.MaxConns) {
+		atomic.AddInt64(&l.conns, -1)
+		return limitConns, false
+	}
+	if n := atomic.AddInt64(&l.pending, 1); l.conf.MaxPendingHandshakes > 0 && n > int64(l.conf.MaxPendingHandshakes) {
+		atomic.AddInt64(&l.pending, -1)
+		atomic.AddInt64(&l.conns, -1)
+		return limitPendingHandshakes, false
+	}
+	return 0, true
+}
+
+// release frees the connection reserved by accept
+func (l *limiter) release() {
+	atomic.AddInt64(&l.conns, -1)
+}
+
+// handshakeDone frees the pending handshake reserved by accept
+func (l *limiter) handshakeDone() {
+	atomic.AddInt64(&l.pending, -1)
+}
+
+// acquireClient reserves a connection of the client
+func (l *limiter) acquireClient(ip net.IP) (limit, bool) {
+	key := ip.String()
+	if l.rate != nil && !l.rate.Allow(key) {
+		return limitClientRate, false
+	}
+	if l.conf.MaxConnsPerClient <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.clients[key] >= l.conf.MaxConnsPerClient {
+		return limitClientConns, false
+	}
+	l.clients[key]++
+	return 0, true
+}
+
+// releaseClient frees the connection reserved by acquireClient
+func (l *limiter) releaseClient(ip net.IP) {
+	if l.conf.MaxConnsPerClient <= 0 {
+		return
+	}
+	key := ip.String()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.clients[key] <= 1 {
+		delete(l.clients, key)
+	} else {
+		l.clients[key]--
+	}
+}
+
+// throttle limits how often a message is logged, the number of messages that
+// were suppressed in between is attached to the next one
+type throttle struct {
+	bucket     *ratelimit.Bucket
+	suppressed uint64
+}
+
+func newThrottle(rate float64, burst int) *throttle {
+	return &throttle{bucket: ratelimit.NewBucket(rate, burst)}
+}
+
+func (t *throttle) warn(msg string, fields ...log.Field) {
+	if !t.bucket.Allow() {
+		atomic.AddUint64(&t.suppressed, 1)
+		return
+	}
+	if n := atomic.SwapUint64(&t.suppressed, 0); n > 0 {
+		fields = append(fields, log.Uint64("suppressed", n))
+	}
+	logger.Warn(msg, fields...)
+}
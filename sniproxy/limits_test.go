@@ -0,0 +1,65 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(&config.Limits{
+		MaxConns:             3,
+		MaxConnsPerClient:    1,
+		ConnRatePerClient:    1,
+		ConnBurstPerClient:   2,
+		MaxPendingHandshakes: 2,
+	})
+	a, b := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+
+	_, ok := l.accept()
+	assert.True(t, ok)
+	_, ok = l.accept()
+	assert.True(t, ok)
+	reason, ok := l.accept()
+	assert.False(t, ok)
+	assert.Equal(t, limitPendingHandshakes, reason)
+
+	l.handshakeDone()
+	_, ok = l.accept()
+	assert.True(t, ok)
+	l.handshakeDone()
+	reason, ok = l.accept()
+	assert.False(t, ok)
+	assert.Equal(t, limitConns, reason)
+
+	_, ok = l.acquireClient(a)
+	assert.True(t, ok)
+	reason, ok = l.acquireClient(a)
+	assert.False(t, ok)
+	assert.Equal(t, limitClientConns, reason)
+	l.releaseClient(a)
+	reason, ok = l.acquireClient(a)
+	assert.False(t, ok)
+	assert.Equal(t, limitClientRate, reason)
+
+	_, ok = l.acquireClient(b)
+	assert.True(t, ok)
+}
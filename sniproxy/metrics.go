@@ -0,0 +1,67 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import "github.com/samuelngs/smartdns/metrics"
+
+// Defines the protocols of the proxied connections
+const (
+	protocolTLS  = "tls"
+	protocolHTTP = "http"
+)
+
+var (
+	connectionsTotal = metrics.NewCounterVec(
+		"smartdns_proxy_connections_total",
+		"Connections accepted by listener port and protocol.",
+		"port", "protocol")
+	activeSessions = metrics.NewGaugeVec(
+		"smartdns_proxy_active_sessions",
+		"Connections currently forwarded to their destination.")
+	handshakeErrors = metrics.NewCounterVec(
+		"smartdns_proxy_handshake_errors_total",
+		"Connections whose destination hostname could not be parsed.",
+		"protocol")
+	dialErrors = metrics.NewCounterVec(
+		"smartdns_proxy_dial_errors_total",
+		"Destinations that could not be connected to.")
+	refusedTotal = metrics.NewCounterVec(
+		"smartdns_proxy_refused_total",
+		"Destinations refused to be proxied by reason.",
+		"reason")
+	limitedTotal = metrics.NewCounterVec(
+		"smartdns_proxy_limited_total",
+		"Connections rejected by a connection limit.",
+		"limit")
+	fingerprintMatches = metrics.NewCounterVec(
+		"smartdns_proxy_fingerprint_matches_total",
+		"TLS clients matched by a configured fingerprint by action.",
+		"fingerprint", "action")
+	echTotal = metrics.NewCounterVec(
+		"smartdns_proxy_ech_total",
+		"Connections with an encrypted ClientHello by policy and result.",
+		"policy", "result")
+	bytesTotal = metrics.NewCounterVec(
+		"smartdns_proxy_bytes_total",
+		"Bytes forwarded by direction, up is sent by the clients.",
+		"direction")
+	sessionDuration = metrics.NewHistogramVec(
+		"smartdns_proxy_session_duration_seconds",
+		"Duration of the connections by protocol.",
+		[]float64{.1, .5, 1, 5, 15, 30, 60, 300, 900, 1800, 3600, 7200},
+		"protocol")
+)
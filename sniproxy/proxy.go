@@ -18,4 +18,4 @@ package sniproxy
 
 import "github.com/samuelngs/smartdns/log"
 
-var logger = log.DefaultLogger
+var logger = log.DefaultLogger.Named("sniproxy")
@@ -17,14 +17,29 @@
 package sniproxy
 
 import (
+	"sync"
+	"time"
+
 	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/log"
 	"golang.org/x/sync/errgroup"
 )
 
+// saveInterval is how often the traffic state is persisted
+const saveInterval = time.Minute
+
 // SNIProxy constructs a sni-proxy server
 type SNIProxy struct {
-	conf    *config.Config
-	servers []*httpServer
+	conf     *config.Config
+	stats    *stats
+	meter    *meter
+	sessions *sessions
+	hosts    *hosts
+	access   *accessLog
+	ech      *echRouter
+	servers  []*httpServer
+	done     chan struct{}
+	stop     sync.Once
 }
 
 // Start initializes and starts sni-proxy server
@@ -33,23 +48,106 @@ func (p *SNIProxy) Start() error {
 	for _, server := range p.servers {
 		eg.Go(server.listen)
 	}
+	go p.saveTraffic()
 	return eg.Wait()
 }
 
 // Stop stops the running sni-proxy server
 func (p *SNIProxy) Stop() error {
+	p.stop.Do(func() { close(p.done) })
 	for _, server := range p.servers {
 		server.shutdown()
 	}
-	return nil
+	p.access.close()
+	return p.meter.save()
+}
+
+func (p *SNIProxy) saveTraffic() {
+	t := time.NewTicker(saveInterval)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			p.meter.evict(now)
+			if err := p.meter.save(); err != nil {
+				logger.Warn("could not save traffic state", log.Error(err))
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// SetQueryHistory sets the dns queries the destinations of the connections
+// with an encrypted ClientHello are looked up in by the history policy
+func (p *SNIProxy) SetQueryHistory(h QueryHistory) {
+	p.ech.setHistory(h)
+}
+
+// Usage returns the traffic of the registered users and the client addresses
+// in the current day and month
+func (p *SNIProxy) Usage() map[string]AccountUsage {
+	return p.meter.usage()
+}
+
+// Sessions returns the connections currently handled by the sni-proxy
+func (p *SNIProxy) Sessions() []SessionInfo {
+	return p.sessions.list()
+}
+
+// Kill closes the session with the id, it returns false if there is no such
+// session
+func (p *SNIProxy) Kill(id uint64) bool {
+	return p.sessions.kill(id)
+}
+
+// TopHosts returns at most n of the hostnames proxied the most
+func (p *SNIProxy) TopHosts(n int) []HostStats {
+	return p.hosts.top(n)
+}
+
+// Stats returns the counters of the sni-proxy server
+func (p *SNIProxy) Stats() Stats {
+	return p.stats.snapshot()
 }
 
 // NewSNIProxy creates a sniproxy server
 func NewSNIProxy(conf *config.Config) *SNIProxy {
-	ports := conf.SNIProxy.AllowedPorts()
+	ports := conf.ProxyPorts()
+	stats := new(stats)
+	dialer := newDialer(conf)
+	limiter := newLimiter(conf.SNIProxy.Limits)
+	rejects := newThrottle(1, 10)
+	meter := newMeter(conf.SNIProxy.Traffic)
+	sessions := newSessions()
+	hosts := newHosts()
+	access := newAccessLog(conf.SNIProxy.AccessLog)
+	ech := new(echRouter)
 	servers := make([]*httpServer, len(ports))
 	for i, port := range ports {
-		servers[i] = &httpServer{conf: conf, port: port}
+		servers[i] = &httpServer{
+			conf:     conf,
+			stats:    stats,
+			dialer:   dialer,
+			limiter:  limiter,
+			rejects:  rejects,
+			meter:    meter,
+			sessions: sessions,
+			hosts:    hosts,
+			access:   access,
+			ech:      ech,
+			port:     port,
+		}
+	}
+	return &SNIProxy{
+		conf:     conf,
+		stats:    stats,
+		meter:    meter,
+		sessions: sessions,
+		hosts:    hosts,
+		access:   access,
+		ech:      ech,
+		servers:  servers,
+		done:     make(chan struct{}),
 	}
-	return &SNIProxy{conf, servers}
 }
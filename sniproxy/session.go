@@ -0,0 +1,250 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samuelngs/smartdns/log"
+	"github.com/samuelngs/smartdns/net/https"
+)
+
+// SessionInfo describes a connection handled by the sni-proxy
+type SessionInfo struct {
+	ID         uint64    `json:"id"`
+	Client     string    `json:"client"`
+	Port       int       `json:"port"`
+	Protocol   string    `json:"protocol"`
+	Hostname   string    `json:"hostname"`
+	ALPN       []string  `json:"alpn,omitempty"`
+	TLSVersion string    `json:"tls_version,omitempty"`
+	JA3        string    `json:"ja3,omitempty"`
+	JA4        string    `json:"ja4,omitempty"`
+	ECH        bool      `json:"ech,omitempty"`
+	Upstream   string    `json:"upstream"`
+	BytesUp    int64     `json:"bytes_up"`
+	BytesDown  int64     `json:"bytes_down"`
+	Start      time.Time `json:"start"`
+	Age        float64   `json:"age_seconds"`
+}
+
+// session is a client connection accepted by the sni-proxy
+type session struct {
+	id   uint64
+	conn *net.TCPConn
+	// client is the address of the client, it differs from the remote
+	// address of the connection when relayed by a trusted load balancer
+	client net.Addr
+	// target is the address the client connected to
+	target net.Addr
+	// log adds the client address to the records
+	log   log.Logger
+	port  int
+	start time.Time
+	// pending is true until the destination hostname has been read
+	pending bool
+	// bytesUp and bytesDown count the data sent by the client and by the
+	// destination respectively
+	bytesUp   int64
+	bytesDown int64
+	account   *account
+
+	// mu guards the fields below, they are read when the sessions are listed
+	mu sync.Mutex
+	// protocol is set once the first bytes of the connection are read
+	protocol string
+	hostname string
+	alpn     []string
+	// tlsVersion is the highest version offered in the ClientHello
+	tlsVersion string
+	ja3, ja4   string
+	ech        bool
+	dst        *net.TCPConn
+	killed     bool
+	// reason is the first reason the session was closed for
+	reason string
+}
+
+func newSession(c *net.TCPConn, port int) *session {
+	s := &session{
+		conn:    c,
+		target:  c.LocalAddr(),
+		port:    port,
+		start:   time.Now(),
+		pending: true,
+	}
+	s.setClient(c.RemoteAddr())
+	return s
+}
+
+// setClient sets the address of the client, it is only called before the
+// session is registered
+func (s *session) setClient(addr net.Addr) {
+	s.client = addr
+	s.log = logger.With(log.Addr("remote-addr", addr))
+}
+
+func (s *session) clientAddr() string {
+	return s.client.String()
+}
+
+func (s *session) setProtocol(protocol string) {
+	s.mu.Lock()
+	s.protocol = protocol
+	s.mu.Unlock()
+}
+
+func (s *session) setHostname(hostname string) {
+	s.mu.Lock()
+	s.hostname = hostname
+	s.mu.Unlock()
+}
+
+// setClientHello records the application protocols, the TLS version, the
+// fingerprints of the client and whether its hello is encrypted
+func (s *session) setClientHello(hello *https.ClientHello) {
+	ja3, ja4 := ja3(hello), ja4(hello)
+	s.mu.Lock()
+	s.alpn = hello.ALPN
+	s.tlsVersion = https.VersionName(hello.TLSVersion())
+	s.ja3, s.ja4 = ja3, ja4
+	s.ech = hello.ECH
+	s.mu.Unlock()
+}
+
+// fingerprints returns the JA3 and JA4 fingerprints of the client
+func (s *session) fingerprints() (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ja3, s.ja4
+}
+
+// closed records the reason the session is closed for unless it already has
+// one, the later reasons are consequences of the first one
+func (s *session) closed(reason string) {
+	s.mu.Lock()
+	if len(s.reason) == 0 {
+		s.reason = reason
+	}
+	s.mu.Unlock()
+}
+
+// attach sets the connection to the destination, it returns false if the
+// session has been killed in the meantime
+func (s *session) attach(dst *net.TCPConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.killed {
+		return false
+	}
+	s.dst = dst
+	return true
+}
+
+// kill closes the connections of the session
+func (s *session) kill() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.killed = true
+	if len(s.reason) == 0 {
+		s.reason = reasonKilled
+	}
+	s.conn.Close()
+	if s.dst != nil {
+		s.dst.Close()
+	}
+}
+
+func (s *session) info() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := SessionInfo{
+		ID:         s.id,
+		Client:     s.clientAddr(),
+		Port:       s.port,
+		Protocol:   s.protocol,
+		Hostname:   s.hostname,
+		ALPN:       s.alpn,
+		TLSVersion: s.tlsVersion,
+		JA3:        s.ja3,
+		JA4:        s.ja4,
+		ECH:        s.ech,
+		BytesUp:    atomic.LoadInt64(&s.bytesUp),
+		BytesDown:  atomic.LoadInt64(&s.bytesDown),
+		Start:      s.start,
+		Age:        time.Since(s.start).Seconds(),
+	}
+	if s.dst != nil {
+		o.Upstream = s.dst.RemoteAddr().String()
+	}
+	return o
+}
+
+// sessions keeps track of the live sessions of all listeners
+type sessions struct {
+	mu   sync.Mutex
+	next uint64
+	m    map[uint64]*session
+}
+
+func newSessions() *sessions {
+	return &sessions{m: make(map[uint64]*session)}
+}
+
+func (r *sessions) add(s *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.next++
+	s.id = r.next
+	r.m[s.id] = s
+}
+
+func (r *sessions) remove(s *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.m, s.id)
+}
+
+func (r *sessions) list() []SessionInfo {
+	r.mu.Lock()
+	list := make([]*session, 0, len(r.m))
+	for _, s := range r.m {
+		list = append(list, s)
+	}
+	r.mu.Unlock()
+
+	o := make([]SessionInfo, len(list))
+	for i, s := range list {
+		o[i] = s.info()
+	}
+	sort.Slice(o, func(i, j int) bool { return o[i].ID < o[j].ID })
+	return o
+}
+
+func (r *sessions) kill(id uint64) bool {
+	r.mu.Lock()
+	s, ok := r.m[id]
+	r.mu.Unlock()
+	if ok {
+		s.kill()
+	}
+	return ok
+}
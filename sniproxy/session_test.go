@@ -0,0 +1,70 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionsKill(t *testing.T) {
+	client, src := connPair(t)
+	dst, server := connPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	r := newSessions()
+	s := newSession(src, 443)
+	r.add(s)
+	s.setProtocol(protocolTLS)
+	s.setHostname("netflix.com")
+	assert.True(t, s.attach(dst))
+
+	done := make(chan error, 1)
+	go func() { done <- proxy(src, dst, time.Minute, nil, nil, nil) }()
+
+	list := r.list()
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, uint64(1), list[0].ID)
+		assert.Equal(t, "netflix.com", list[0].Hostname)
+		assert.Equal(t, protocolTLS, list[0].Protocol)
+		assert.Equal(t, 443, list[0].Port)
+		assert.Equal(t, dst.RemoteAddr().String(), list[0].Upstream)
+	}
+
+	assert.False(t, r.kill(2))
+	assert.True(t, r.kill(1))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("killed session is still forwarding")
+	}
+
+	// both ends see the connection closed
+	b, _ := ioutil.ReadAll(client)
+	assert.Empty(t, b)
+	b, _ = ioutil.ReadAll(server)
+	assert.Empty(t, b)
+
+	// a killed session does not take a destination anymore
+	assert.False(t, s.attach(dst))
+	r.remove(s)
+	assert.Empty(t, r.list())
+}
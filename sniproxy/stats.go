@@ -0,0 +1,50 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import "sync/atomic"
+
+// Stats contains the counters of a sni-proxy server
+type Stats struct {
+	Refused uint64
+	// Limited counts the connections rejected by each connection limit
+	Limited map[string]uint64
+}
+
+type stats struct {
+	refused uint64
+	limited [numLimits]uint64
+}
+
+func (s *stats) addRefused() {
+	atomic.AddUint64(&s.refused, 1)
+}
+
+func (s *stats) addLimited(l limit) {
+	atomic.AddUint64(&s.limited[l], 1)
+}
+
+func (s *stats) snapshot() Stats {
+	o := Stats{
+		Refused: atomic.LoadUint64(&s.refused),
+		Limited: make(map[string]uint64, numLimits),
+	}
+	for l := limit(0); l < numLimits; l++ {
+		o.Limited[l.String()] = atomic.LoadUint64(&s.limited[l])
+	}
+	return o
+}
@@ -0,0 +1,373 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/log"
+	"github.com/samuelngs/smartdns/metrics"
+	"github.com/samuelngs/smartdns/ratelimit"
+)
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// accountIdle is how long an account of a client address is kept after its
+// last session when there is no quota to enforce on it
+const accountIdle = time.Hour
+
+// account tracks the traffic of a registered user or a client address in
+// the current day and month
+type account struct {
+	name string
+
+	// sessions and released are guarded by the mutex of the meter
+	sessions int
+	released time.Time
+
+	mu           sync.Mutex
+	dailyQuota   int64
+	monthlyQuota int64
+	bucket       *ratelimit.Bucket
+	throttle     *ratelimit.Bucket
+	day          string
+	month        string
+	daily        int64
+	monthly      int64
+}
+
+// AccountUsage is the traffic of an account in the current periods
+type AccountUsage struct {
+	Day     string `json:"day"`
+	Daily   int64  `json:"daily"`
+	Month   string `json:"month"`
+	Monthly int64  `json:"monthly"`
+}
+
+// rotate resets the counters when a period has ended
+func (a *account) rotate(now time.Time) {
+	if day := now.Format(dayLayout); day != a.day {
+		a.day, a.daily = day, 0
+	}
+	if month := now.Format(monthLayout); month != a.month {
+		a.month, a.monthly = month, 0
+	}
+}
+
+// configure applies the rate limit and the quotas of the configuration, the
+// buckets are created once and kept with their state across sessions
+func (a *account) configure(rate, daily, monthly, throttle int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.bucket == nil && rate > 0 {
+		a.bucket = newRateBucket(rate)
+	}
+	if a.throttle == nil && throttle > 0 {
+		a.throttle = newRateBucket(throttle)
+	}
+	a.dailyQuota, a.monthlyQuota = daily, monthly
+}
+
+// rate returns the rate limit of the account, or nil if it has none
+func (a *account) rate() *ratelimit.Bucket {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.bucket
+}
+
+// throttled returns the throttle of the account once a quota is exhausted,
+// or nil otherwise
+func (a *account) throttled() *ratelimit.Bucket {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.throttle == nil || !a.over() {
+		return nil
+	}
+	return a.throttle
+}
+
+func (a *account) add(n int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rotate(time.Now().UTC())
+	a.daily += n
+	a.monthly += n
+}
+
+func (a *account) exhausted() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.over()
+}
+
+// over returns true if a quota is exhausted, the mutex must be held
+func (a *account) over() bool {
+	a.rotate(time.Now().UTC())
+	return (a.dailyQuota > 0 && a.daily >= a.dailyQuota) ||
+		(a.monthlyQuota > 0 && a.monthly >= a.monthlyQuota)
+}
+
+func (a *account) usage() AccountUsage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rotate(time.Now().UTC())
+	return AccountUsage{Day: a.day, Daily: a.daily, Month: a.month, Monthly: a.monthly}
+}
+
+// meter accounts the traffic of every user and client address
+type meter struct {
+	conf     *config.Traffic
+	mu       sync.Mutex
+	accounts map[string]*account
+}
+
+func newMeter(conf *config.Traffic) *meter {
+	m := &meter{conf: conf, accounts: make(map[string]*account)}
+	if err := m.load(); err != nil {
+		logger.Warn("could not load traffic state", log.Error(err))
+	}
+	return m
+}
+
+// account returns the account of the registered user that owns the address,
+// or the account of the address itself, the account has to be released once
+// the session ends
+func (m *meter) account(ip net.IP) *account {
+	name := ip.String()
+	rate, daily, monthly := m.conf.ClientRate, m.conf.DailyQuota, m.conf.MonthlyQuota
+	if user := m.conf.MatchUser(ip); user != nil {
+		name = "user:" + user.Name
+		rate, daily, monthly = user.Rate, user.DailyQuota, user.MonthlyQuota
+	}
+	var throttle int64
+	if m.conf.OnExhausted == config.QuotaThrottle {
+		throttle = m.conf.ThrottleRate
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[name]
+	if !ok {
+		a = &account{name: name}
+		m.accounts[name] = a
+	}
+	a.configure(rate, daily, monthly, throttle)
+	a.sessions++
+	return a
+}
+
+// release marks the end of a session of the account
+func (m *meter) release(a *account) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a.sessions--
+	a.released = time.Now()
+}
+
+// evict removes the accounts of client addresses that have had no session
+// for a while, unless they carry traffic a quota is enforced on. The
+// accounts of registered users are kept.
+func (m *meter) evict(now time.Time) {
+	quota := m.conf.DailyQuota > 0 || m.conf.MonthlyQuota > 0
+	month := now.UTC().Format(monthLayout)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, a := range m.accounts {
+		if a.sessions > 0 || strings.HasPrefix(name, "user:") || now.Sub(a.released) < accountIdle {
+			continue
+		}
+		a.mu.Lock()
+		used := a.month == month && a.monthly > 0
+		a.mu.Unlock()
+		if !quota || !used {
+			delete(m.accounts, name)
+		}
+	}
+}
+
+// usage returns the traffic of all accounts
+func (m *meter) usage() map[string]AccountUsage {
+	m.mu.Lock()
+	accounts := make([]*account, 0, len(m.accounts))
+	for _, a := range m.accounts {
+		accounts = append(accounts, a)
+	}
+	m.mu.Unlock()
+
+	o := make(map[string]AccountUsage, len(accounts))
+	for _, a := range accounts {
+		o[a.name] = a.usage()
+	}
+	return o
+}
+
+func (m *meter) load() error {
+	if len(m.conf.StateFile) == 0 {
+		return nil
+	}
+	b, err := ioutil.ReadFile(m.conf.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state map[string]AccountUsage
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, u := range state {
+		m.accounts[name] = &account{
+			name:    name,
+			day:     u.Day,
+			daily:   u.Daily,
+			month:   u.Month,
+			monthly: u.Monthly,
+		}
+	}
+	return nil
+}
+
+// save writes the traffic of the accounts that are used in the current month
+// to the state file atomically
+func (m *meter) save() error {
+	if len(m.conf.StateFile) == 0 {
+		return nil
+	}
+	state := m.usage()
+	month := time.Now().UTC().Format(monthLayout)
+	for name, u := range state {
+		if u.Month != month || u.Monthly == 0 {
+			delete(state, name)
+		}
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.conf.StateFile, b)
+}
+
+// writeFileAtomic writes the data to a temporary file and renames it over
+// the destination so that readers never see a partial file
+func writeFileAtomic(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func newRateBucket(rate int64) *ratelimit.Bucket {
+	burst := rate
+	if burst > math.MaxInt32 {
+		burst = math.MaxInt32
+	}
+	return ratelimit.NewBucket(float64(rate), int(burst))
+}
+
+// flow accounts and shapes the data forwarded in one direction of a session
+type flow struct {
+	bytes *int64
+	// total is the counter of all the bytes forwarded in the direction
+	total   *metrics.Counter
+	account *account
+	// buckets are the rate limits of the connection and the account
+	buckets []*ratelimit.Bucket
+}
+
+// limits returns the rate limits in effect, the throttle applies on top of
+// them once the quota of the account is exhausted
+func (f *flow) limits() []*ratelimit.Bucket {
+	if f.account == nil {
+		return f.buckets
+	}
+	if throttle := f.account.throttled(); throttle != nil {
+		return append(f.buckets[:len(f.buckets):len(f.buckets)], throttle)
+	}
+	return f.buckets
+}
+
+// chunk returns how many bytes can be moved at most by the next copy, the
+// chunks are kept below the rate limits to pace the data evenly
+func (f *flow) chunk() int64 {
+	n := int64(chunkSize)
+	if f == nil {
+		return n
+	}
+	for _, b := range f.limits() {
+		if burst := b.Burst(); burst < n {
+			n = burst
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// add records the forwarded bytes and returns how long to pause before the
+// next copy to keep within the rate limits
+func (f *flow) add(n int64) time.Duration {
+	if f == nil {
+		return 0
+	}
+	atomic.AddInt64(f.bytes, n)
+	if f.total != nil {
+		f.total.Add(float64(n))
+	}
+	if f.account != nil {
+		f.account.add(n)
+	}
+
+	var wait time.Duration
+	for _, b := range f.limits() {
+		if w := b.Take(int(n)); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 smartdns authors
+// This file is part of the smartdns library.
+//
+// The smartdns library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The smartdns library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the smartdns library. If not, see <http://www.gnu.org/licenses/>.
+
+package sniproxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/smartdns/config"
+	"github.com/samuelngs/smartdns/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeterQuota(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smartdns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := config.DefaultTraffic()
+	conf.DailyQuota = 100
+	conf.StateFile = filepath.Join(dir, "traffic.json")
+	conf.Users = []*config.User{{Name: "alice", IPs: []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")}, MonthlyQuota: 1000}}
+
+	m := newMeter(conf)
+	a := m.account(net.ParseIP("192.0.2.1"))
+	a.add(600)
+	assert.False(t, a.exhausted())
+	m.account(net.ParseIP("192.0.2.2")).add(400)
+	assert.True(t, a.exhausted())
+
+	c := m.account(net.ParseIP("198.51.100.1"))
+	c.add(100)
+	assert.True(t, c.exhausted())
+
+	// the traffic is restored from the state file
+	assert.NoError(t, m.save())
+	m = newMeter(conf)
+	assert.Equal(t, int64(1000), m.usage()["user:alice"].Monthly)
+	assert.True(t, m.account(net.ParseIP("198.51.100.1")).exhausted())
+}
+
+func TestMeterEvict(t *testing.T) {
+	conf := config.DefaultTraffic()
+	conf.Users = []*config.User{{Name: "alice", IPs: []net.IP{net.ParseIP("192.0.2.1")}}}
+	m := newMeter(conf)
+
+	for _, ip := range []string{"192.0.2.1", "198.51.100.1", "198.51.100.2"} {
+		a := m.account(net.ParseIP(ip))
+		a.add(100)
+		m.release(a)
+	}
+	active := m.account(net.ParseIP("198.51.100.3"))
+
+	m.evict(time.Now())
+	assert.Len(t, m.usage(), 4)
+
+	// the idle client addresses are evicted without a quota to enforce
+	m.evict(time.Now().Add(accountIdle))
+	assert.Equal(t, []string{"198.51.100.3", "user:alice"}, usageNames(m))
+	m.release(active)
+
+	// with a quota only the accounts without traffic are evicted
+	conf.DailyQuota = 1000
+	a := m.account(net.ParseIP("198.51.100.1"))
+	a.add(100)
+	m.release(a)
+	m.evict(time.Now().Add(accountIdle))
+	assert.Equal(t, []string{"198.51.100.1", "user:alice"}, usageNames(m))
+}
+
+func TestMeterParallelSessions(t *testing.T) {
+	conf := config.DefaultTraffic()
+	conf.OnExhausted = config.QuotaThrottle
+	conf.ThrottleRate = 1 << 20
+	conf.Users = []*config.User{{Name: "alice", IPs: []net.IP{net.ParseIP("192.0.2.1")}, Rate: 1 << 30, DailyQuota: 16 << 10}}
+	m := newMeter(conf)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, src := connPair(t)
+			dst, server := connPair(t)
+			defer client.Close()
+			defer server.Close()
+
+			a := m.account(net.ParseIP("192.0.2.1"))
+			defer m.release(a)
+			var n int64
+			f := &flow{bytes: &n, account: a, buckets: []*ratelimit.Bucket{a.rate()}}
+			go forward(dst, src, time.Second, nil, nil, f)
+			go func() {
+				client.Write(bytes.Repeat([]byte{0}, 64<<10))
+				client.CloseWrite()
+			}()
+			b, err := ioutil.ReadAll(server)
+			assert.NoError(t, err)
+			assert.Len(t, b, 64<<10)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(128<<10), m.usage()["user:alice"].Daily)
+}
+
+func usageNames(m *meter) []string {
+	var names []string
+	for name := range m.usage() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestForwardShaping(t *testing.T) {
+	client, src := connPair(t)
+	dst, server := connPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	var n int64
+	f := &flow{bytes: &n, buckets: []*ratelimit.Bucket{ratelimit.NewBucket(64<<10, 16<<10)}}
+
+	start := time.Now()
+	go forward(dst, src, time.Second, nil, nil, f)
+	go func() {
+		client.Write(bytes.Repeat([]byte{0}, 48<<10))
+		client.CloseWrite()
+	}()
+	b, err := ioutil.ReadAll(server)
+	assert.NoError(t, err)
+	assert.Len(t, b, 48<<10)
+	assert.Equal(t, int64(48<<10), atomic.LoadInt64(&n))
+
+	// the burst is sent right away and the rest is paced at the rate
+	assert.True(t, time.Since(start) >= time.Millisecond*400)
+}